@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Siman73000/school-planner-gobackend/api_utils"
+)
+
+func Compact(w http.ResponseWriter, r *http.Request) {
+	h := api_utils.DefaultHandler()
+	api_utils.WithRequestID(api_utils.WithLogging(api_utils.WithTimeoutAfter(h.ServeCompact, h.Config.Timeout)))(w, r)
+}
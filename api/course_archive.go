@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Siman73000/school-planner-gobackend/api_utils"
+)
+
+func CourseArchive(w http.ResponseWriter, r *http.Request) {
+	h := api_utils.DefaultHandler()
+	api_utils.WithRequestID(api_utils.WithLogging(api_utils.WithTimeoutAfter(h.ServeCourseArchive, h.Config.Timeout)))(w, r)
+}
@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Siman73000/school-planner-gobackend/api_utils"
+)
+
+// Events is not wrapped in WithTimeout: the stream is meant to outlive the
+// usual request budget, and each KV read gets its own deadline instead.
+func Events(w http.ResponseWriter, r *http.Request) {
+	h := api_utils.DefaultHandler()
+	api_utils.WithRequestID(api_utils.WithLogging(h.ServeEvents))(w, r)
+}
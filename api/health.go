@@ -1,15 +1,12 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
-	"time"
+
+	"github.com/Siman73000/school-planner-gobackend/api_utils"
 )
 
 func Health(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"ok":   true,
-		"time": time.Now().UTC().Format(time.RFC3339Nano),
-	})
+	h := api_utils.DefaultHandler()
+	api_utils.WithRequestID(api_utils.WithLogging(api_utils.WithTimeoutAfter(h.ServeHealth, h.Config.Timeout)))(w, r)
 }
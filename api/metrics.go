@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Siman73000/school-planner-gobackend/api_utils"
+)
+
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	api_utils.WithRequestID(api_utils.WithLogging(serveMetrics))(w, r)
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Metrics reveal traffic patterns, so unlike the planner endpoints
+	// they stay closed when no API key is configured.
+	if strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		api_utils.WriteError(w, http.StatusForbidden, api_utils.CodeForbidden, "metrics require PLANNER_API_KEY")
+		return
+	}
+	if !api_utils.AuthorizeAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	api_utils.Metrics.WriteText(w)
+}
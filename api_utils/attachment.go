@@ -0,0 +1,100 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AttachmentTypes are the content types a task attachment may have: the
+// rubric images and PDFs students actually attach. Anything else, HTML
+// in particular, would be served back from our origin, so it is refused.
+var AttachmentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+}
+
+// AttachmentMaxBytes returns PLANNER_ATTACHMENT_MAX_BYTES, the largest
+// attachment accepted (default 512 KiB). Stored values are base64, a
+// third bigger, and must fit in one Upstash request.
+func AttachmentMaxBytes() int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("PLANNER_ATTACHMENT_MAX_BYTES")), 10, 64)
+	if err != nil || n <= 0 {
+		return 512 << 10
+	}
+	return n
+}
+
+// AttachmentKey returns the key holding the attachment of a task in the
+// planner at stateKey; its content type lives at the same key plus
+// ":type". Keys are per planner so one user can't read another's
+// attachments by guessing a task id.
+func AttachmentKey(stateKey, taskID string) string {
+	return "attachment:" + stateKey + ":" + taskID
+}
+
+// SaveAttachment stores data and its content type at key in one
+// transaction. Upstash replies in JSON, which can't carry arbitrary bytes,
+// so the data is stored base64-encoded. Attachments have no TTL of their
+// own: they are deleted when their task is removed from the planner or
+// the planner is hard reset, and Compact deletes those left behind by a
+// planner that expired.
+func SaveAttachment(ctx context.Context, c KV, key, contentType string, data []byte) error {
+	return c.Pipeline(ctx, []KVOp{
+		{Kind: KVSet, Key: key, Value: []byte(base64.StdEncoding.EncodeToString(data))},
+		{Kind: KVSet, Key: key + ":type", Value: []byte(contentType)},
+	})
+}
+
+// LoadAttachment returns the attachment stored at key and its content
+// type, if there is one.
+func LoadAttachment(ctx context.Context, c KV, key string) (data []byte, contentType string, found bool, err error) {
+	vals, ok, err := c.MGet(ctx, key, key+":type")
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !ok[0] || !ok[1] {
+		return nil, "", false, nil
+	}
+	data, err = base64.StdEncoding.DecodeString(vals[0])
+	if err != nil {
+		return nil, "", false, fmt.Errorf("%w: attachment %s is not base64", ErrBadResponse, key)
+	}
+	return data, vals[1], true, nil
+}
+
+// DeleteAttachment removes the attachment at key, if any.
+func DeleteAttachment(ctx context.Context, c KV, key string) error {
+	return c.Pipeline(ctx, deleteAttachmentOps(key))
+}
+
+// deleteAttachmentOps returns the Pipeline ops that delete the attachment
+// at key.
+func deleteAttachmentOps(key string) []KVOp {
+	return []KVOp{
+		{Kind: KVDel, Key: key},
+		{Kind: KVDel, Key: key + ":type"},
+	}
+}
+
+// attachmentOwners returns the planners and task ids an attachment key
+// may belong to. Task ids can contain colons, so
+// "attachment:app_state:alice:t1" is either alice's task "t1" or the
+// shared planner's task "alice:t1".
+func attachmentOwners(key string) (stateKeys, taskIDs []string) {
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(key, ":type"), "attachment:"+legacyStateKey+":")
+	if !ok {
+		return nil, nil
+	}
+	stateKeys, taskIDs = []string{legacyStateKey}, []string{rest}
+	if id, task, ok := strings.Cut(rest, ":"); ok && task != "" && validUserID(id) {
+		stateKeys, taskIDs = append(stateKeys, StateKey(id)), append(taskIDs, task)
+	}
+	return stateKeys, taskIDs
+}
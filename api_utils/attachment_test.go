@@ -0,0 +1,103 @@
+package api_utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAttachmentOutlivesStateTTLWrites(t *testing.T) {
+	t.Setenv("PLANNER_STATE_TTL", "1h")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	now := time.Now()
+	mem.now = func() time.Time { return now }
+	akey := AttachmentKey(StateKey("alice"), "t1")
+	if err := SaveAttachment(ctx, mem, akey, "image/png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Long after upload the planner is still in use, so its attachment
+	// must still be there.
+	now = now.Add(2 * time.Hour)
+	if _, _, found, err := LoadAttachment(ctx, mem, akey); err != nil || !found {
+		t.Fatalf("attachment of a live planner expired: found=%v, %v", found, err)
+	}
+}
+
+func TestRemovingTaskDeletesAttachment(t *testing.T) {
+	t.Setenv("PLANNER_READONLY", "")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	key := StateKey("alice")
+	if _, err := MutateState(ctx, mem, key, func(st *AppState) error {
+		st.Tasks = []map[string]any{{"id": "t1", "title": "a"}, {"id": "t2", "title": "b"}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		SaveAttachment(ctx, mem, AttachmentKey(key, id), "application/pdf", []byte("%PDF"))
+	}
+
+	if _, err := MutateState(ctx, mem, key, func(st *AppState) error {
+		st.Tasks = st.Tasks[1:]
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found, _ := LoadAttachment(ctx, mem, AttachmentKey(key, "t1")); found {
+		t.Error("attachment of the removed task is still stored")
+	}
+	if _, _, found, _ := LoadAttachment(ctx, mem, AttachmentKey(key, "t2")); !found {
+		t.Error("attachment of the kept task was deleted")
+	}
+}
+
+func TestAttachmentOwners(t *testing.T) {
+	keys, tasks := attachmentOwners(AttachmentKey(StateKey("alice"), "t1") + ":type")
+	if !reflect.DeepEqual(keys, []string{"app_state", "app_state:alice"}) || !reflect.DeepEqual(tasks, []string{"alice:t1", "t1"}) {
+		t.Errorf("owners = %v %v", keys, tasks)
+	}
+	keys, tasks = attachmentOwners(AttachmentKey(StateKey(""), "t1"))
+	if !reflect.DeepEqual(keys, []string{"app_state"}) || !reflect.DeepEqual(tasks, []string{"t1"}) {
+		t.Errorf("owners = %v %v", keys, tasks)
+	}
+}
+
+func TestCompactAttachments(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	mem.SetBody(ctx, StateKey("alice"), []byte(`{"version":2,"tasks":[{"id":"t1","title":"a"}]}`))
+	mem.SetBody(ctx, StateKey(""), []byte(`{"version":2,"tasks":[{"id":"bob:t9","title":"a"}]}`))
+
+	keep := []string{
+		AttachmentKey(StateKey("alice"), "t1"),
+		// Bob's planner is gone, but the key also reads as the shared
+		// planner's task "bob:t9", which exists.
+		AttachmentKey(StateKey("bob"), "t9"),
+	}
+	drop := []string{
+		AttachmentKey(StateKey("alice"), "t2"),
+		AttachmentKey(StateKey("carol"), "t1"),
+	}
+	for _, k := range append(append([]string{}, keep...), drop...) {
+		SaveAttachment(ctx, mem, k, "image/png", []byte("png"))
+	}
+
+	n, err := compactAttachments(ctx, mem)
+	if err != nil || n != 2*len(drop) {
+		t.Fatalf("compactAttachments = %d, %v; want %d keys", n, err, 2*len(drop))
+	}
+	for _, k := range keep {
+		if _, _, found, _ := LoadAttachment(ctx, mem, k); !found {
+			t.Errorf("%s was deleted", k)
+		}
+	}
+	for _, k := range drop {
+		if _, _, found, _ := LoadAttachment(ctx, mem, k); found {
+			t.Errorf("%s was kept", k)
+		}
+	}
+}
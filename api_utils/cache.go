@@ -0,0 +1,153 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateCache holds recently read or written state blobs by state key, so
+// a warm instance answering the same client's polling doesn't go to the
+// store every time. Entries are cachedBlob values.
+var stateCache sync.Map
+
+type cachedBlob struct {
+	body    []byte
+	expires time.Time
+	// ttlRefreshed records that RefreshStateTTL already ran for this
+	// entry, so reads it serves don't restart the expiry again.
+	ttlRefreshed bool
+}
+
+// StateCacheTTL returns PLANNER_STATE_CACHE_TTL (e.g. "3s"). Unset or
+// invalid disables the cache. Each instance has its own cache, so another
+// instance's write can take up to this long to show up here.
+func StateCacheTTL() time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("PLANNER_STATE_CACHE_TTL")))
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// ReadStateBlobCached is ReadStateBlob served from the in-process cache
+// when a fresh entry exists.
+func ReadStateBlobCached(ctx context.Context, c KV, key string) ([]byte, error) {
+	ttl := StateCacheTTL()
+	if ttl <= 0 {
+		return ReadStateBlob(ctx, c, key)
+	}
+	if v, ok := stateCache.Load(key); ok {
+		if e := v.(cachedBlob); time.Now().Before(e.expires) {
+			return e.body, nil
+		}
+		stateCache.Delete(key)
+	}
+	body, err := ReadStateBlob(ctx, c, key)
+	if err != nil {
+		return nil, err
+	}
+	stateCache.Store(key, cachedBlob{body: body, expires: time.Now().Add(ttl)})
+	return body, nil
+}
+
+// cacheStateWrite records a blob just written under key, keeping this
+// instance's caches in step with its own writes.
+func cacheStateWrite(key string, body []byte) {
+	rememberGood(key, body)
+	ttl := StateCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+	stateCache.Store(key, cachedBlob{body: body, expires: time.Now().Add(ttl)})
+}
+
+// claimTTLRefresh reports whether the TTL of the planner at key should be
+// restarted now. With the cache on, only the first read of each cached
+// entry does it: the planner can't come close to expiring within one
+// cache window, and skipping the round trip is the point of the cache.
+func claimTTLRefresh(key string) bool {
+	v, ok := stateCache.Load(key)
+	if !ok {
+		return true
+	}
+	e := v.(cachedBlob)
+	if !time.Now().Before(e.expires) {
+		return true
+	}
+	if e.ttlRefreshed {
+		return false
+	}
+	e.ttlRefreshed = true
+	stateCache.Store(key, e)
+	return true
+}
+
+// InvalidateStateCache drops any cached blob for key, including the
+// last-known-good copy. Call it after changing the key other than through
+// SaveState.
+func InvalidateStateCache(key string) {
+	stateCache.Delete(key)
+	lastGoodMu.Lock()
+	delete(lastGood, key)
+	lastGoodMu.Unlock()
+}
+
+// lastGood holds the last blob each planner was successfully read or
+// written as, for ServeStale. It is capped at lastGoodMax planners; past
+// that an arbitrary one is dropped.
+var (
+	lastGoodMu sync.Mutex
+	lastGood   = map[string][]byte{}
+)
+
+const lastGoodMax = 1000
+
+// ServeStale reports whether PLANNER_SERVE_STALE=1 is set. Then, when the
+// store can't be read, GET /api/state answers with the last copy this
+// instance saw, marked X-Stale: true, instead of failing. The copy only
+// lives as long as the warm instance does.
+func ServeStale() bool {
+	return strings.TrimSpace(os.Getenv("PLANNER_SERVE_STALE")) == "1"
+}
+
+func rememberGood(key string, body []byte) {
+	if !ServeStale() {
+		return
+	}
+	lastGoodMu.Lock()
+	defer lastGoodMu.Unlock()
+	if _, ok := lastGood[key]; !ok && len(lastGood) >= lastGoodMax {
+		for k := range lastGood {
+			delete(lastGood, k)
+			break
+		}
+	}
+	lastGood[key] = body
+}
+
+// ReadStateBlobOrStale is ReadStateBlobCached that, with ServeStale on,
+// falls back to the last-known-good copy when the store can't be reached;
+// stale reports that it did. A stored blob that is corrupt is still an
+// error: an old copy would hide it.
+func ReadStateBlobOrStale(ctx context.Context, c KV, key string) (body []byte, stale bool, err error) {
+	body, err = ReadStateBlobCached(ctx, c, key)
+	if err == nil {
+		rememberGood(key, body)
+		return body, false, nil
+	}
+	if !ServeStale() || errors.Is(err, ErrBadStateBlob) || errors.Is(err, ErrSchemaVersion) {
+		return nil, false, err
+	}
+	lastGoodMu.Lock()
+	good, ok := lastGood[key]
+	lastGoodMu.Unlock()
+	if !ok {
+		return nil, false, err
+	}
+	LoggerFrom(ctx).Warn("serving stale state", "key", key, "error", err.Error())
+	return good, true, nil
+}
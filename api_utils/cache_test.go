@@ -0,0 +1,40 @@
+package api_utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCachedReadsRefreshTTLOnce(t *testing.T) {
+	t.Setenv("PLANNER_STATE_TTL", "1h")
+	t.Setenv("PLANNER_STATE_CACHE_TTL", "1m")
+	ctx := context.Background()
+	c := newCountingKV()
+	key := StateKey("alice")
+	c.SetBody(ctx, key, []byte(`{"version":2}`))
+	t.Cleanup(func() { InvalidateStateCache(key) })
+
+	read := func() {
+		t.Helper()
+		if _, _, err := ReadStateBlobOrStale(ctx, c, key); err != nil {
+			t.Fatal(err)
+		}
+		RefreshStateTTL(ctx, c, key)
+	}
+	for i := 0; i < 5; i++ {
+		read()
+	}
+	if n := c.calls["GetString"]; n != 1 {
+		t.Fatalf("store read %d times, want 1; the test no longer hits the cache", n)
+	}
+	if n := c.calls["Pipeline"]; n != 1 {
+		t.Errorf("TTL refreshed %d times within one cache window, want 1", n)
+	}
+
+	// Once the entry is gone the next read refreshes again.
+	InvalidateStateCache(key)
+	read()
+	if n := c.calls["Pipeline"]; n != 2 {
+		t.Errorf("TTL refreshed %d times after a cache miss, want 2", n)
+	}
+}
@@ -0,0 +1,102 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// MarshalState encodes st the way it is stored, so equal planners always
+// encode to the same bytes and so to the same ETag: numbers set in Go (ints,
+// json.Number, float32, -0) are written as the float64 they decode back to.
+// st and the maps it holds are not modified.
+func MarshalState(st AppState) ([]byte, error) {
+	st.Courses, _ = canonicalizeItems(st.Courses)
+	st.Tasks, _ = canonicalizeItems(st.Tasks)
+	st.Grades, _ = canonicalizeItems(st.Grades)
+	if s, ok := canonicalize(st.Settings); ok {
+		st.Settings = s.(map[string]any)
+	}
+	return json.Marshal(st)
+}
+
+// canonicalizeItems returns items with each item canonicalized, copying
+// the slice only if an item changed.
+func canonicalizeItems(items []map[string]any) (out []map[string]any, changed bool) {
+	for i, it := range items {
+		if c, ok := canonicalize(it); ok {
+			if out == nil {
+				out = slices.Clone(items)
+			}
+			out[i] = c.(map[string]any)
+		}
+	}
+	if out == nil {
+		return items, false
+	}
+	return out, true
+}
+
+// canonicalize returns v with its numbers as decoded JSON would hold them,
+// and whether that differs from v. -0 becomes 0. v is never written to: a
+// map or slice with a changed value is copied, and unchanged ones are
+// returned as they are.
+func canonicalize(v any) (out any, changed bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		var cp map[string]any
+		for k, x := range v {
+			if c, ok := canonicalize(x); ok {
+				if cp == nil {
+					cp = maps.Clone(v)
+				}
+				cp[k] = c
+			}
+		}
+		if cp != nil {
+			return cp, true
+		}
+	case []any:
+		var cp []any
+		for i, x := range v {
+			if c, ok := canonicalize(x); ok {
+				if cp == nil {
+					cp = slices.Clone(v)
+				}
+				cp[i] = c
+			}
+		}
+		if cp != nil {
+			return cp, true
+		}
+	case []map[string]any:
+		if c, ok := canonicalizeItems(v); ok {
+			return c, true
+		}
+	case float64:
+		if v == 0 && math.Signbit(v) {
+			return 0.0, true
+		}
+	case float32:
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return f, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			out, _ := canonicalize(f)
+			return out, true
+		}
+	}
+	return v, false
+}
@@ -0,0 +1,79 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestMarshalStateStableNumbers(t *testing.T) {
+	// Built in Go with mixed number types...
+	built := AppState{
+		Version: 1,
+		Courses: []map[string]any{{"id": "c1", "credits": 3, "color": json.Number("2.50")}},
+		Tasks:   []map[string]any{{"id": "t1", "order": int64(7), "offset": math.Copysign(0, -1)}},
+		Grades:  []map[string]any{{"id": "g1", "weight": float32(0.1), "parts": []any{uint(1), int32(2)}}},
+		Settings: map[string]any{
+			"week":   map[string]any{"start": json.Number("1")},
+			"scores": []map[string]any{{"max": 100}},
+		},
+	}
+	// ...and the same planner as decoded JSON holds it.
+	decoded := AppState{
+		Version: 1,
+		Courses: []map[string]any{{"id": "c1", "credits": 3.0, "color": 2.5}},
+		Tasks:   []map[string]any{{"id": "t1", "order": 7.0, "offset": 0.0}},
+		Grades:  []map[string]any{{"id": "g1", "weight": 0.1, "parts": []any{1.0, 2.0}}},
+		Settings: map[string]any{
+			"week":   map[string]any{"start": 1.0},
+			"scores": []map[string]any{{"max": 100.0}},
+		},
+	}
+
+	a, err := MarshalState(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MarshalState(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatalf("equal states encoded differently:\n%s\n%s", a, b)
+	}
+
+	// Reading the stored bytes back and encoding again changes nothing.
+	var again AppState
+	if err := json.Unmarshal(a, &again); err != nil {
+		t.Fatal(err)
+	}
+	c, err := MarshalState(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, c) {
+		t.Fatalf("round trip changed the bytes:\n%s\n%s", a, c)
+	}
+}
+
+func TestMarshalStateLeavesInputAlone(t *testing.T) {
+	week := map[string]any{"start": json.Number("1")}
+	course := map[string]any{"id": "c1", "credits": 3}
+	st := AppState{
+		Courses:  []map[string]any{course},
+		Settings: map[string]any{"week": week},
+	}
+	if _, err := MarshalState(st); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := course["credits"].(int); !ok {
+		t.Errorf("course credits became %T", course["credits"])
+	}
+	if _, ok := week["start"].(json.Number); !ok {
+		t.Errorf("settings week start became %T", week["start"])
+	}
+	if st.Courses[0]["credits"] != 3 {
+		t.Errorf("state course was replaced")
+	}
+}
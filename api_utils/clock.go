@@ -0,0 +1,27 @@
+package api_utils
+
+import "time"
+
+// clock is where the planner reads the current time. It is time.Now
+// unless a test swaps it with SetClock.
+var clock = time.Now
+
+// Now returns the current time from the planner's clock. Use it for
+// anything a user can see or that depends on the date: timestamps, what is
+// overdue, the current week. Timers that measure latency or wait on locks
+// keep using time.Now, since a frozen clock would stall them.
+func Now() time.Time {
+	return clock()
+}
+
+// SetClock makes Now return fn() until the returned restore func is
+// called, so time-dependent behavior can be tested deterministically:
+//
+//	defer api_utils.SetClock(func() time.Time { return fixed })()
+//
+// It is not safe to call while requests are being served.
+func SetClock(fn func() time.Time) (restore func()) {
+	prev := clock
+	clock = fn
+	return func() { clock = prev }
+}
@@ -0,0 +1,52 @@
+package api_utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSetClock(t *testing.T) {
+	fixed := time.Date(2026, 9, 1, 8, 0, 0, 0, time.UTC)
+	restore := SetClock(func() time.Time { return fixed })
+	if got := Now(); !got.Equal(fixed) {
+		t.Fatalf("Now() = %v, want %v", got, fixed)
+	}
+
+	// Overrides nest: each restore brings back the clock it replaced.
+	later := fixed.Add(time.Hour)
+	restoreInner := SetClock(func() time.Time { return later })
+	if got := Now(); !got.Equal(later) {
+		t.Fatalf("inner Now() = %v, want %v", got, later)
+	}
+	restoreInner()
+	if got := Now(); !got.Equal(fixed) {
+		t.Fatalf("after inner restore Now() = %v, want %v", got, fixed)
+	}
+
+	restore()
+	if got := Now(); time.Since(got) > time.Minute || got.Equal(fixed) {
+		t.Fatalf("after restore Now() = %v, want the real time", got)
+	}
+}
+
+func TestMutateStateUsesClock(t *testing.T) {
+	t.Setenv("PLANNER_READONLY", "")
+	mem := NewMemoryKV()
+	defer SetClock(func() time.Time { return testNow })()
+
+	st, err := MutateState(context.Background(), mem, StateKey("alice"), func(st *AppState) error {
+		st.Tasks = append(st.Tasks, map[string]any{"id": "t1", "title": "Essay"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testNow.Format(time.RFC3339Nano)
+	if st.UpdatedAt != want {
+		t.Errorf("UpdatedAt = %q, want %q", st.UpdatedAt, want)
+	}
+	if i := IndexByID(st.Tasks, "t1"); i < 0 || st.Tasks[i]["updatedAt"] != want {
+		t.Errorf("new task = %v, want updatedAt %q", st.Tasks, want)
+	}
+}
@@ -0,0 +1,228 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompactReport is what Compact removed, by kind.
+type CompactReport struct {
+	// Idempotency counts idempotency records past idempotencyTTL or too
+	// damaged to replay.
+	Idempotency int `json:"idempotency"`
+	// History counts history lists whose planner no longer exists.
+	History int `json:"history"`
+	// Snapshots counts snapshots trimmed from lists longer than
+	// HistoryLimit. They are entries, not keys, so Total leaves them out.
+	Snapshots int `json:"snapshots"`
+	// RateLimit counts rate-limit counters for windows that have passed.
+	RateLimit int `json:"rateLimit"`
+	// Attachments counts attachment keys whose planner or task is gone.
+	Attachments int `json:"attachments"`
+	// Total is the number of keys deleted.
+	Total int `json:"total"`
+}
+
+// Compact scans the store for leftovers that normally expire on their own
+// but can pile up when a TTL is lost (a failed EXPIRE, a restored dump)
+// and deletes them. It is safe to run at any time: nothing it removes is
+// still in use.
+func Compact(ctx context.Context, c KV, now time.Time) (CompactReport, error) {
+	var rep CompactReport
+	var err error
+	if rep.Idempotency, err = compactIdempotency(ctx, c, now); err != nil {
+		return rep, err
+	}
+	if rep.History, rep.Snapshots, err = compactHistory(ctx, c); err != nil {
+		return rep, err
+	}
+	if rep.RateLimit, err = compactRateLimits(ctx, c, now); err != nil {
+		return rep, err
+	}
+	if rep.Attachments, err = compactAttachments(ctx, c); err != nil {
+		return rep, err
+	}
+	rep.Total = rep.Idempotency + rep.History + rep.RateLimit + rep.Attachments
+	return rep, nil
+}
+
+func compactIdempotency(ctx context.Context, c KV, now time.Time) (int, error) {
+	keys, err := c.ListKeys(ctx, "idem:")
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	vals, found, err := mgetBatched(ctx, c, keys)
+	if err != nil {
+		return 0, err
+	}
+	var stale []string
+	for i, k := range keys {
+		if !found[i] {
+			continue
+		}
+		var res IdempotentResult
+		if err := json.Unmarshal([]byte(vals[i]), &res); err != nil {
+			stale = append(stale, k)
+			continue
+		}
+		// Records from before SavedAt existed are left to their TTL.
+		saved, err := time.Parse(time.RFC3339, res.SavedAt)
+		if err == nil && now.Sub(saved) > idempotencyTTL {
+			stale = append(stale, k)
+		}
+	}
+	return len(stale), deleteKeys(ctx, c, stale)
+}
+
+// compactHistory deletes history lists of planners that are gone and
+// trims the rest to HistoryLimit.
+func compactHistory(ctx context.Context, c KV) (removed, trimmed int, err error) {
+	keys, err := c.ListKeys(ctx, legacyStateKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	var lists, owners []string
+	for _, k := range keys {
+		if owner, ok := strings.CutSuffix(k, ":"+historySuffix); ok {
+			lists = append(lists, k)
+			owners = append(owners, owner)
+		}
+	}
+	if len(lists) == 0 {
+		return 0, 0, nil
+	}
+	_, found, err := mgetBatched(ctx, c, owners)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit := HistoryLimit()
+	var orphans []string
+	for i, hk := range lists {
+		if !found[i] || limit == 0 {
+			orphans = append(orphans, hk)
+			continue
+		}
+		vals, err := c.LRange(ctx, hk, int64(limit), -1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		if err := c.LTrim(ctx, hk, 0, int64(limit-1)); err != nil {
+			return 0, 0, err
+		}
+		trimmed += len(vals)
+	}
+	return len(orphans), trimmed, deleteKeys(ctx, c, orphans)
+}
+
+// compactRateLimits deletes fixed-window counters for earlier minutes and
+// sliding-window logs with nothing left in the last minute.
+func compactRateLimits(ctx context.Context, c KV, now time.Time) (int, error) {
+	keys, err := c.ListKeys(ctx, "ratelimit:")
+	if err != nil {
+		return 0, err
+	}
+	current := now.Unix() / 60
+	zs, _ := c.(ZSetKV)
+	var stale []string
+	for _, k := range keys {
+		_, window, fixed := strings.Cut(strings.TrimPrefix(k, "ratelimit:"), ":")
+		if fixed {
+			if w, err := strconv.ParseInt(window, 10, 64); err == nil && w < current {
+				stale = append(stale, k)
+			}
+			continue
+		}
+		if zs == nil {
+			continue
+		}
+		if err := zs.ZRemRangeByScore(ctx, k, math.Inf(-1), float64(now.UnixMilli()-60_000)); err != nil {
+			return 0, err
+		}
+		n, err := zs.ZCard(ctx, k)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			stale = append(stale, k)
+		}
+	}
+	return len(stale), deleteKeys(ctx, c, stale)
+}
+
+// compactAttachments deletes attachments whose task no longer exists in
+// any planner the key could belong to, e.g. because the planner expired.
+// A planner that can't be decoded keeps its attachments.
+func compactAttachments(ctx context.Context, c KV) (int, error) {
+	keys, err := c.ListKeys(ctx, "attachment:")
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	var stateKeys []string
+	index := map[string]int{}
+	for _, k := range keys {
+		owners, _ := attachmentOwners(k)
+		for _, sk := range owners {
+			if _, ok := index[sk]; !ok {
+				index[sk] = len(stateKeys)
+				stateKeys = append(stateKeys, sk)
+			}
+		}
+	}
+	vals, found, err := mgetBatched(ctx, c, stateKeys)
+	if err != nil {
+		return 0, err
+	}
+	// tasks[i] holds the task ids of stateKeys[i], and keepAll[i] is set
+	// when that planner exists but can't be read.
+	tasks := make([]map[string]bool, len(stateKeys))
+	keepAll := make([]bool, len(stateKeys))
+	for i := range stateKeys {
+		if !found[i] {
+			continue
+		}
+		var doc struct {
+			Tasks []map[string]any `json:"tasks"`
+		}
+		if json.Unmarshal([]byte(vals[i]), &doc) != nil {
+			keepAll[i] = true
+			continue
+		}
+		tasks[i] = map[string]bool{}
+		for _, t := range doc.Tasks {
+			if id, _ := t["id"].(string); id != "" {
+				tasks[i][id] = true
+			}
+		}
+	}
+	var stale []string
+	for _, k := range keys {
+		owners, taskIDs := attachmentOwners(k)
+		live := len(owners) == 0 // not a key this code wrote; leave it
+		for j, sk := range owners {
+			i := index[sk]
+			live = live || keepAll[i] || tasks[i][taskIDs[j]]
+		}
+		if !live {
+			stale = append(stale, k)
+		}
+	}
+	return len(stale), deleteKeys(ctx, c, stale)
+}
+
+func deleteKeys(ctx context.Context, c KV, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ops := make([]KVOp, len(keys))
+	for i, k := range keys {
+		ops[i] = KVOp{Kind: KVDel, Key: k}
+	}
+	return c.Pipeline(ctx, ops)
+}
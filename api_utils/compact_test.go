@@ -0,0 +1,46 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCompactBatchesMGet(t *testing.T) {
+	t.Setenv("PLANNER_HISTORY_LIMIT", "10")
+	ctx := context.Background()
+	kv := newCountingKV()
+	n := 2*mgetBatch + 50
+
+	stale, _ := json.Marshal(IdempotentResult{Status: 200, SavedAt: testNow.Add(-time.Hour).Format(time.RFC3339)})
+	fresh, _ := json.Marshal(IdempotentResult{Status: 200, SavedAt: testNow.Format(time.RFC3339)})
+	for i := 0; i < n; i++ {
+		rec := stale
+		if i%2 == 0 {
+			rec = fresh
+		}
+		kv.SetBody(ctx, fmt.Sprintf("idem:%s:%d", StateKey(""), i), rec)
+
+		// Every other user's planner is gone, leaving its history behind.
+		key := StateKey(fmt.Sprint("user", i))
+		if err := pushSnapshot(ctx, kv.MemoryKV, key, `{"version":2}`); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			kv.SetBody(ctx, key, []byte(`{"version":2}`))
+		}
+	}
+
+	rep, err := Compact(ctx, kv, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.maxMGet > mgetBatch {
+		t.Fatalf("one MGet asked for %d keys, want at most %d", kv.maxMGet, mgetBatch)
+	}
+	if rep.Idempotency != n/2 || rep.History != n/2 {
+		t.Fatalf("report = %+v, want %d idempotency records and %d history lists", rep, n/2, n/2)
+	}
+}
@@ -0,0 +1,52 @@
+package api_utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// compressedPrefix marks values written with compression enabled. Upstash
+// returns values inside JSON strings, so the gzip bytes are base64 encoded
+// to survive the round trip. A planner blob is a JSON object and can never
+// start with this prefix, which keeps plain values readable.
+const compressedPrefix = "gz1:"
+
+func compressValue(value []byte) ([]byte, error) {
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(value); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(compressedPrefix)+base64.StdEncoding.EncodedLen(zbuf.Len()))
+	copy(out, compressedPrefix)
+	base64.StdEncoding.Encode(out[len(compressedPrefix):], zbuf.Bytes())
+	return out, nil
+}
+
+// decompressValue returns s unchanged unless it carries compressedPrefix.
+func decompressValue(s string) (string, error) {
+	if !strings.HasPrefix(s, compressedPrefix) {
+		return s, nil
+	}
+	z, err := base64.StdEncoding.DecodeString(s[len(compressedPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("decode compressed value: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(z))
+	if err != nil {
+		return "", fmt.Errorf("decode compressed value: %w", err)
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("decode compressed value: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,45 @@
+package api_utils
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ApplyCORS sets Access-Control-Allow-Origin from PLANNER_CORS_ORIGINS, a
+// comma-separated allowlist. The request's Origin is echoed back only when
+// it is listed; "*" in the list allows any origin. With the variable unset
+// no CORS header is sent, so only same-origin pages can call the API.
+// Preflight answers also carry Access-Control-Max-Age so browsers cache
+// them.
+func ApplyCORS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	for _, allowed := range strings.Split(os.Getenv("PLANNER_CORS_ORIGINS"), ",") {
+		allowed = strings.TrimSpace(allowed)
+		switch {
+		case allowed == "*":
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case allowed != "" && origin != "" && strings.EqualFold(strings.TrimRight(allowed, "/"), origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		default:
+			continue
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(CORSMaxAge()))
+		}
+		return
+	}
+}
+
+// CORSMaxAge returns PLANNER_CORS_MAX_AGE, how many seconds browsers may
+// cache a preflight (default 600). Browsers cap it themselves, Chrome at
+// two hours.
+func CORSMaxAge() int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("PLANNER_CORS_MAX_AGE")))
+	if err != nil || n < 0 {
+		return 600
+	}
+	return n
+}
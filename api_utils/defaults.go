@@ -0,0 +1,67 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	defaultStateOnce sync.Once
+	defaultStateJSON []byte // the validated template, nil for the built-in one
+)
+
+// DefaultState returns the planner a new user starts with. Deployments
+// can ship their own starter template (semester name, theme, starter
+// courses) as JSON in PLANNER_DEFAULT_STATE, or in the file named by
+// PLANNER_DEFAULT_STATE_FILE. The template is read and validated once; if
+// it is missing or invalid the built-in default is used and the problem
+// is logged. Each call returns a fresh copy the caller may modify.
+func DefaultState() AppState {
+	defaultStateOnce.Do(func() {
+		b, err := loadDefaultTemplate()
+		if err != nil {
+			Logger.Error("default state template rejected; using the built-in default", "error", err.Error())
+			return
+		}
+		defaultStateJSON = b
+	})
+	if defaultStateJSON != nil {
+		var st AppState
+		if err := json.Unmarshal(defaultStateJSON, &st); err == nil {
+			return st
+		}
+	}
+	return builtinDefaultState()
+}
+
+// loadDefaultTemplate reads the configured template and returns it
+// migrated, normalized and encoded, or nil when none is configured.
+func loadDefaultTemplate() ([]byte, error) {
+	raw := []byte(strings.TrimSpace(os.Getenv("PLANNER_DEFAULT_STATE")))
+	source := "PLANNER_DEFAULT_STATE"
+	if len(raw) == 0 {
+		path := strings.TrimSpace(os.Getenv("PLANNER_DEFAULT_STATE_FILE"))
+		if path == "" {
+			return nil, nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw, source = b, path
+	}
+	st, _, err := Migrate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	st.Revision = 0
+	st.UpdatedAt = ""
+	NormalizeState(&st)
+	if errs := ValidateState(st); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", source, &ValidationError{Errors: errs})
+	}
+	return MarshalState(st)
+}
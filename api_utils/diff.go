@@ -0,0 +1,90 @@
+package api_utils
+
+import (
+	"reflect"
+	"sort"
+)
+
+// StateDiff describes how the courses, tasks and grades of one state
+// differ from another's. Items are matched by id.
+type StateDiff struct {
+	Courses CollectionDiff `json:"courses"`
+	Tasks   CollectionDiff `json:"tasks"`
+	Grades  CollectionDiff `json:"grades"`
+}
+
+// CollectionDiff lists items only in the newer state (Added), only in the
+// older one (Removed), and in both with different contents (Changed).
+type CollectionDiff struct {
+	Added   []map[string]any `json:"added"`
+	Removed []map[string]any `json:"removed"`
+	Changed []ItemChange     `json:"changed"`
+}
+
+// ItemChange is one item present on both sides of a diff. Fields names the
+// keys whose values differ, sorted.
+type ItemChange struct {
+	ID     string         `json:"id"`
+	Fields []string       `json:"fields"`
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+}
+
+// DiffState compares a (older) with b (newer).
+func DiffState(a, b AppState) StateDiff {
+	return StateDiff{
+		Courses: diffItems(a.Courses, b.Courses),
+		Tasks:   diffItems(a.Tasks, b.Tasks),
+		Grades:  diffItems(a.Grades, b.Grades),
+	}
+}
+
+// diffItems matches items by id; items without one can't be matched and
+// are ignored. Added and Changed follow b's order, Removed follows a's.
+func diffItems(a, b []map[string]any) CollectionDiff {
+	d := CollectionDiff{Added: []map[string]any{}, Removed: []map[string]any{}, Changed: []ItemChange{}}
+	before := map[string]map[string]any{}
+	for _, it := range a {
+		if id, ok := it["id"].(string); ok {
+			before[id] = it
+		}
+	}
+	seen := map[string]bool{}
+	for _, it := range b {
+		id, ok := it["id"].(string)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+		old, existed := before[id]
+		if !existed {
+			d.Added = append(d.Added, it)
+			continue
+		}
+		if fields := changedFields(old, it); len(fields) > 0 {
+			d.Changed = append(d.Changed, ItemChange{ID: id, Fields: fields, Before: old, After: it})
+		}
+	}
+	for _, it := range a {
+		if id, ok := it["id"].(string); ok && !seen[id] {
+			d.Removed = append(d.Removed, it)
+		}
+	}
+	return d
+}
+
+func changedFields(a, b map[string]any) []string {
+	var fields []string
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !reflect.DeepEqual(v, w) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,67 @@
+package api_utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffState(t *testing.T) {
+	a := AppState{
+		Courses: []map[string]any{
+			{"id": "c1", "name": "Math", "color": "#f00"},
+			{"id": "c2", "name": "Art"},
+		},
+		Tasks: []map[string]any{
+			{"id": "t1", "title": "Essay", "done": false},
+			{"name": "no id"},
+		},
+	}
+	b := AppState{
+		Courses: []map[string]any{
+			{"id": "c1", "name": "Calculus", "color": "#f00", "room": "B2"},
+			{"id": "c3", "name": "Music"},
+		},
+		Tasks: []map[string]any{
+			{"id": "t1", "title": "Essay", "done": false},
+			{"name": "still no id"},
+		},
+		Grades: []map[string]any{{"id": "g1", "scoreEarned": 9.0}},
+	}
+
+	d := DiffState(a, b)
+
+	if len(d.Courses.Added) != 1 || d.Courses.Added[0]["id"] != "c3" {
+		t.Errorf("courses added = %v, want c3", d.Courses.Added)
+	}
+	if len(d.Courses.Removed) != 1 || d.Courses.Removed[0]["id"] != "c2" {
+		t.Errorf("courses removed = %v, want c2", d.Courses.Removed)
+	}
+	if len(d.Courses.Changed) != 1 {
+		t.Fatalf("courses changed = %v, want c1", d.Courses.Changed)
+	}
+	ch := d.Courses.Changed[0]
+	if ch.ID != "c1" || !reflect.DeepEqual(ch.Fields, []string{"name", "room"}) {
+		t.Errorf("c1 change = %s %v, want fields [name room]", ch.ID, ch.Fields)
+	}
+	if ch.Before["name"] != "Math" || ch.After["name"] != "Calculus" {
+		t.Errorf("c1 before/after = %v / %v", ch.Before, ch.After)
+	}
+
+	// Unchanged and id-less tasks don't show up at all.
+	if n := len(d.Tasks.Added) + len(d.Tasks.Removed) + len(d.Tasks.Changed); n != 0 {
+		t.Errorf("tasks diff = %+v, want empty", d.Tasks)
+	}
+	if len(d.Grades.Added) != 1 || len(d.Grades.Removed) != 0 {
+		t.Errorf("grades diff = %+v, want g1 added", d.Grades)
+	}
+}
+
+func TestDiffStateEmptyListsNotNil(t *testing.T) {
+	d := DiffState(AppState{}, AppState{})
+	for name, c := range map[string]CollectionDiff{"courses": d.Courses, "tasks": d.Tasks, "grades": d.Grades} {
+		// Nil slices would encode as null rather than [].
+		if c.Added == nil || c.Removed == nil || c.Changed == nil {
+			t.Errorf("%s diff has nil lists: %+v", name, c)
+		}
+	}
+}
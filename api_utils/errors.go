@@ -0,0 +1,42 @@
+package api_utils
+
+import "net/http"
+
+// Error codes sent in the "code" field of every error response, next to
+// the human-readable "error" message. Clients branch on the code, so an
+// existing code never changes meaning; new situations get new codes.
+const (
+	CodeInvalidRequest       = "invalid_request"        // a query parameter or header is missing or malformed
+	CodeInvalidJSON          = "invalid_json"           // the body is not the JSON the endpoint expects
+	CodeInvalidCSV           = "invalid_csv"            // a CSV body has a malformed header or can't be parsed
+	CodeBodyTooLarge         = "body_too_large"         // the body exceeds MaxBodyBytes
+	CodeBodyTooComplex       = "body_too_complex"       // the body nests too deeply or holds too many items
+	CodeBodyIncomplete       = "body_incomplete"        // the body ended early
+	CodeBodyTimeout          = "body_timeout"           // the body took too long to arrive
+	CodeBodyUnreadable       = "body_unreadable"        // the body could not be read
+	CodeUnauthorized         = "unauthorized"           // missing or invalid API key or token
+	CodeInvalidSignature     = "invalid_signature"      // X-Signature is missing or doesn't match the body
+	CodeForbidden            = "forbidden"              // the endpoint is disabled in this deployment
+	CodeNotFound             = "not_found"              // the requested course, snapshot, etc. does not exist
+	CodeInvalidState         = "invalid_state"          // the resulting planner failed validation; see "errors"
+	CodeInvalidPatch         = "invalid_patch"          // a PATCH body has an unknown field or wrong shape
+	CodeVersionConflict      = "version_conflict"       // the write was based on a stale revision; see "state"
+	CodePreconditionFailed   = "precondition_failed"    // If-Match didn't match the stored state
+	CodeUnsupportedMediaType = "unsupported_media_type" // the body's Content-Type isn't one the endpoint accepts
+	CodeUnsupportedSchema    = "unsupported_schema"     // the schema version asked for or sent is not supported
+	CodeIdempotencyMismatch  = "idempotency_mismatch"   // an Idempotency-Key was reused with a different body
+	CodeRateLimited          = "rate_limited"           // too many requests; see Retry-After
+	CodeStateLocked          = "state_locked"           // another write holds the planner; retry shortly
+	CodeReadOnly             = "read_only"              // writes are paused for maintenance; see Retry-After
+	CodeStateCorrupt         = "state_corrupt"          // stored data is not a valid planner
+	CodeKVTimeout            = "kv_timeout"             // the KV store did not answer in time
+	CodeKVUnreachable        = "kv_unreachable"         // the KV store failed or could not be reached
+	CodeKVThrottled          = "kv_throttled"           // Upstash refused the call for exceeding the plan's rate
+	CodeMisconfigured        = "misconfigured"          // the server is missing required configuration
+	CodeInternal             = "internal"               // anything else that went wrong on our side
+)
+
+// WriteError writes the standard error body {"error": msg, "code": code}.
+func WriteError(w http.ResponseWriter, status int, code, msg string) {
+	WriteJSON(w, status, map[string]any{"error": msg, "code": code})
+}
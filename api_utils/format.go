@@ -0,0 +1,162 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Media types a planner can be exchanged in. JSON is the canonical form;
+// YAML and TOML are conveniences for editing a backup by hand and carry
+// exactly the same document.
+const (
+	MediaJSON = "application/json"
+	MediaYAML = "application/yaml"
+	MediaTOML = "application/toml"
+)
+
+// mediaAliases maps other names clients use to the canonical media type.
+var mediaAliases = map[string]string{
+	"application/json":   MediaJSON,
+	"application/yaml":   MediaYAML,
+	"application/x-yaml": MediaYAML,
+	"text/yaml":          MediaYAML,
+	"text/x-yaml":        MediaYAML,
+	"application/toml":   MediaTOML,
+	"application/x-toml": MediaTOML,
+	"text/toml":          MediaTOML,
+}
+
+// MediaExtensions gives the file extension for each media type, for
+// download names.
+var MediaExtensions = map[string]string{
+	MediaJSON: ".json",
+	MediaYAML: ".yaml",
+	MediaTOML: ".toml",
+}
+
+// ErrUnsupportedMedia is returned by EncodeAs and DecodeFrom for a media
+// type other than the Media constants.
+var ErrUnsupportedMedia = errors.New("unsupported content type")
+
+// NegotiateMedia picks the media type to answer with from an Accept
+// header: the supported type with the highest q-value, JSON when nothing
+// supported is listed or the header is empty.
+func NegotiateMedia(accept string) string {
+	best, bestQ := MediaJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		media, ok := mediaAliases[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	return best
+}
+
+// RequestMedia returns the canonical media type of a Content-Type header.
+// Anything that isn't YAML or TOML is read as JSON, as bodies always were,
+// since many clients send JSON as text/plain or with no type at all.
+func RequestMedia(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return MediaJSON
+	}
+	if media, ok := mediaAliases[mt]; ok {
+		return media
+	}
+	return MediaJSON
+}
+
+// EncodeAs converts a JSON document to media. Object keys come out
+// sorted. TOML has no null, so null values are left out there, and whole
+// numbers are written as integers rather than 2.0.
+func EncodeAs(media string, raw []byte) ([]byte, error) {
+	if media == MediaJSON {
+		return raw, nil
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	switch media {
+	case MediaYAML:
+		return yaml.Marshal(doc)
+	case MediaTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(tomlValue(doc)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedMedia, media)
+}
+
+// DecodeFrom converts a document in media to JSON, so it can go through
+// the same decoding and validation as a JSON body.
+func DecodeFrom(media string, body []byte) ([]byte, error) {
+	var doc any
+	switch media {
+	case MediaJSON:
+		return body, nil
+	case MediaYAML:
+		if err := yaml.Unmarshal(body, &doc); err != nil {
+			return nil, err
+		}
+	case MediaTOML:
+		var m map[string]any
+		if err := toml.Unmarshal(body, &m); err != nil {
+			return nil, err
+		}
+		doc = m
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedMedia, media)
+	}
+	return json.Marshal(doc)
+}
+
+// tomlValue adapts a decoded JSON value for TOML: null object members and
+// array elements are removed and whole numbers become integers,
+// recursively.
+func tomlValue(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			if e != nil {
+				out[k] = tomlValue(e)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(x))
+		for _, e := range x {
+			if e != nil {
+				out = append(out, tomlValue(e))
+			}
+		}
+		return out
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return int64(x)
+		}
+	}
+	return v
+}
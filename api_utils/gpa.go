@@ -0,0 +1,135 @@
+package api_utils
+
+import "math"
+
+// CourseGPA is one course's line in a GPA report.
+type CourseGPA struct {
+	CourseID string  `json:"courseId"`
+	Name     string  `json:"name"`
+	Credits  float64 `json:"credits"`
+	Percent  float64 `json:"percent"`
+	Value    float64 `json:"value"`
+	Grades   int     `json:"grades"`
+}
+
+// GPAReport is the result of ComputeGPA. Overall is nil when no grade
+// could be used.
+type GPAReport struct {
+	Scale   float64     `json:"scale"`
+	Overall *float64    `json:"overall"`
+	Courses []CourseGPA `json:"courses"`
+}
+
+// ComputeGPA averages grades per course (weighted by each grade's weight)
+// and then across courses (weighted by credits). scale is 100 for plain
+// percentages or 4 for the usual letter-grade point scale. Grades whose
+// scores are missing or malformed are skipped.
+func ComputeGPA(st AppState, scale float64) GPAReport {
+	type acc struct {
+		sum, weight float64
+		n           int
+	}
+	byCourse := map[string]*acc{}
+	var order []string
+	for _, g := range st.Grades {
+		pct, ok := GradePercent(g)
+		if !ok {
+			continue
+		}
+		w := 1.0
+		if v, present := g["weight"]; present && v != nil {
+			f, isF := v.(float64)
+			if !isF || f <= 0 {
+				continue
+			}
+			w = f
+		}
+		cid := ItemCourseID(g)
+		a := byCourse[cid]
+		if a == nil {
+			a = &acc{}
+			byCourse[cid] = a
+			order = append(order, cid)
+		}
+		a.sum += pct * w
+		a.weight += w
+		a.n++
+	}
+
+	rep := GPAReport{Scale: scale, Courses: []CourseGPA{}}
+	var total, credits float64
+	for _, cid := range order {
+		a := byCourse[cid]
+		cg := CourseGPA{CourseID: cid, Name: "No course", Credits: 1, Grades: a.n}
+		if i := IndexByID(st.Courses, cid); i >= 0 {
+			c := st.Courses[i]
+			if name, ok := c["name"].(string); ok {
+				cg.Name = name
+			}
+			if cr, ok := c["credits"].(float64); ok && cr > 0 {
+				cg.Credits = cr
+			}
+		}
+		cg.Percent = round2(a.sum / a.weight)
+		cg.Value = round2(scaleValue(a.sum/a.weight, scale))
+		rep.Courses = append(rep.Courses, cg)
+		total += scaleValue(a.sum/a.weight, scale) * cg.Credits
+		credits += cg.Credits
+	}
+	if credits > 0 {
+		v := round2(total / credits)
+		rep.Overall = &v
+	}
+	return rep
+}
+
+// GradePercent returns a grade as a 0-100 percentage. It prefers
+// scoreEarned/scoreTotal (what the web app stores) and falls back to a
+// bare score already expressed as a percentage.
+func GradePercent(g map[string]any) (float64, bool) {
+	earned, okE := g["scoreEarned"].(float64)
+	total, okT := g["scoreTotal"].(float64)
+	if okE && okT && total > 0 {
+		return earned / total * 100, true
+	}
+	if s, ok := g["score"].(float64); ok {
+		return s, true
+	}
+	return 0, false
+}
+
+// scaleValue converts a percentage to the requested scale.
+func scaleValue(pct, scale float64) float64 {
+	if scale != 4 {
+		return pct
+	}
+	switch {
+	case pct >= 93:
+		return 4.0
+	case pct >= 90:
+		return 3.7
+	case pct >= 87:
+		return 3.3
+	case pct >= 83:
+		return 3.0
+	case pct >= 80:
+		return 2.7
+	case pct >= 77:
+		return 2.3
+	case pct >= 73:
+		return 2.0
+	case pct >= 70:
+		return 1.7
+	case pct >= 67:
+		return 1.3
+	case pct >= 63:
+		return 1.0
+	case pct >= 60:
+		return 0.7
+	}
+	return 0
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
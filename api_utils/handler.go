@@ -0,0 +1,215 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the settings a Handler reads once, when it is built.
+type Config struct {
+	// RateLimitPerMinute caps /api/state requests per caller; 0 disables it.
+	RateLimitPerMinute int
+	// Timeout bounds each request; see WithTimeoutAfter.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads Config from PLANNER_RATE_LIMIT and
+// PLANNER_HANDLER_TIMEOUT.
+func ConfigFromEnv() Config {
+	return Config{
+		RateLimitPerMinute: RateLimitPerMinute(),
+		Timeout:            HandlerTimeout(),
+	}
+}
+
+// Handler serves the planner endpoints from an injected store and config,
+// so tests can run them against a MemoryKV:
+//
+//	h := api_utils.NewHandler(api_utils.NewMemoryKV(), api_utils.Config{})
+//	h.ServeState(w, r)
+type Handler struct {
+	KV     KV
+	Config Config
+
+	// kvErr is why KV could not be built, reported per request as a
+	// misconfiguration.
+	kvErr error
+}
+
+func NewHandler(kv KV, cfg Config) *Handler {
+	return &Handler{KV: kv, Config: cfg}
+}
+
+var (
+	defaultHandlerMu sync.Mutex
+	defaultHandler   *Handler
+)
+
+// DefaultHandler returns the Handler the serverless entrypoints share,
+// built from the environment on first use and reused by warm instances.
+// If the store isn't configured, the returned Handler reports that on
+// each request and a later call tries again.
+func DefaultHandler() *Handler {
+	defaultHandlerMu.Lock()
+	defer defaultHandlerMu.Unlock()
+	if defaultHandler != nil {
+		return defaultHandler
+	}
+	kv, err := NewKVFromEnv()
+	h := &Handler{KV: kv, Config: ConfigFromEnv(), kvErr: err}
+	if err == nil {
+		defaultHandler = h
+	}
+	return h
+}
+
+// Store returns the Handler's KV, or the error that kept it from being
+// built.
+func (h *Handler) Store() (KV, error) {
+	if h.kvErr != nil {
+		return nil, h.kvErr
+	}
+	return h.KV, nil
+}
+
+// ServeHealth serves /api/health: it pings the store and reports how that
+// went, answering 503 when the store is unreachable or not configured.
+func (h *Handler) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	kv, ok := h.checkKV(r)
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, map[string]any{
+		"ok":       ok,
+		"time":     Now().UTC().Format(time.RFC3339Nano),
+		"readOnly": ReadOnly(),
+		// 0 means planners never expire.
+		"stateTtlSeconds": int64(StateTTL() / time.Second),
+		"kv":              kv,
+	})
+}
+
+// ServeLive serves /api/live, a liveness probe: it answers 200 whenever
+// the process can serve requests and never touches the store, so a KV
+// outage doesn't get healthy instances restarted.
+func (h *Handler) ServeLive(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// ServeReady serves /api/ready, a readiness probe: 200 when the store
+// answers a ping, 503 otherwise.
+func (h *Handler) ServeReady(w http.ResponseWriter, r *http.Request) {
+	kv, ok := h.checkKV(r)
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, map[string]any{"ok": ok, "kv": kv})
+}
+
+// checkKV pings the store and describes the result for the health
+// endpoints. ok is false when the store is unconfigured or unreachable.
+func (h *Handler) checkKV(r *http.Request) (kv map[string]any, ok bool) {
+	kv = map[string]any{}
+	client, err := h.Store()
+	if err != nil {
+		kv["configured"] = false
+		kv["error"] = err.Error()
+		return kv, false
+	}
+	kv["configured"] = true
+	kv["backend"] = client.Backend()
+	if u, ok := client.(*UpstashClient); ok {
+		kv["timeout_ms"] = u.HTTP.Timeout.Milliseconds()
+	}
+	// Stores that can count keys do it in the same round trip as the
+	// ping; the key count is left out when it couldn't be read.
+	start := time.Now()
+	if ip, ok := client.(InfoPinger); ok {
+		var info KVInfo
+		info, err = ip.PingInfo(r.Context())
+		if info.Keys >= 0 {
+			kv["keys"] = info.Keys
+		}
+	} else {
+		err = client.Ping(r.Context())
+	}
+	kv["latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+	kv["connected"] = err == nil
+	if err != nil {
+		kv["error"] = err.Error()
+		return kv, false
+	}
+	return kv, true
+}
+
+// selfTestTTL bounds how long a canary can outlive a self-test that died
+// before deleting it.
+const selfTestTTL = 30 * time.Second
+
+// ServeSelfTest serves /api/selftest: beyond the ping /api/health does, it
+// writes a canary key, reads it back and deletes it, reporting write_ok.
+// That catches stores that answer but don't keep writes, such as a
+// read-only replica or the wrong database. It writes, so it needs
+// PLANNER_API_KEY.
+func (h *Handler) ServeSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		WriteError(w, http.StatusForbidden, CodeForbidden, "selftest requires PLANNER_API_KEY")
+		return
+	}
+	if !AuthorizeAdmin(w, r) {
+		return
+	}
+
+	kv, ok := h.checkKV(r)
+	res := map[string]any{"kv": kv, "write_ok": false}
+	if ok {
+		client, _ := h.Store()
+		start := time.Now()
+		err := writeCanary(r.Context(), client)
+		res["write_latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			res["write_error"] = err.Error()
+		}
+		ok = err == nil
+		res["write_ok"] = ok
+	}
+	res["ok"] = ok
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, res)
+}
+
+// writeCanary stores a random value under a fresh key, checks that it
+// reads back unchanged and deletes it.
+func writeCanary(ctx context.Context, c KV) error {
+	key, want := "selftest:"+NewID(), NewID()
+	if err := c.SetBodyWithTTL(ctx, key, []byte(want), selfTestTTL); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	got, err := c.GetString(ctx, key)
+	if err != nil {
+		return fmt.Errorf("read back: %w", err)
+	}
+	if err := c.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if got != want {
+		return errors.New("read back a different value than was written")
+	}
+	return nil
+}
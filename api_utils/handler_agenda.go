@@ -0,0 +1,110 @@
+package api_utils
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	_ "time/tzdata" // ?tz= must work on hosts without a zoneinfo database
+)
+
+// ServeAgenda serves /api/agenda: one week of tasks grouped by due date.
+func (h *Handler) ServeAgenda(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// Days are calendar days in ?tz (an IANA zone name), UTC by default,
+	// so tasks due late in the evening land on the day the user expects.
+	q := r.URL.Query()
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "unknown tz "+tz)
+			return
+		}
+		loc = l
+	}
+	day := Now().In(loc)
+	if s := q.Get("week"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, s); err != nil {
+				WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "week must be a date (YYYY-MM-DD) or RFC3339 timestamp")
+				return
+			}
+		}
+		day = t.In(loc)
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	if exclude, _ := strconv.ParseBool(q.Get("excludeArchived")); exclude {
+		st = WithoutArchived(st)
+	}
+
+	weekStartsOn := WeekStartsOn(st)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	start = start.AddDate(0, 0, -((int(start.Weekday()) - weekStartsOn + 7) % 7))
+	end := start.AddDate(0, 0, 7)
+
+	days := make(map[string][]map[string]any, 7)
+	for i := 0; i < 7; i++ {
+		days[start.AddDate(0, 0, i).Format("2006-01-02")] = []map[string]any{}
+	}
+	undated := []map[string]any{}
+	for _, t := range st.Tasks {
+		if IsDeleted(t) {
+			continue
+		}
+		due, ok := TaskDue(t)
+		if !ok {
+			undated = append(undated, t)
+			continue
+		}
+		due = due.In(loc)
+		if due.Before(start) || !due.Before(end) {
+			continue
+		}
+		k := due.Format("2006-01-02")
+		days[k] = append(days[k], t)
+	}
+	for _, tasks := range days {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			a, _ := TaskDue(tasks[i])
+			b, _ := TaskDue(tasks[j])
+			return a.Before(b)
+		})
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"weekStart":    start.Format("2006-01-02"),
+		"weekEnd":      end.AddDate(0, 0, -1).Format("2006-01-02"),
+		"weekStartsOn": weekStartsOn,
+		"timeZone":     loc.String(),
+		"days":         days,
+		"undated":      undated,
+	})
+}
@@ -0,0 +1,72 @@
+package api_utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// ServeChanges serves /api/changes: the items changed and the tombstones
+// pushed since ?since=, for offline sync.
+func (h *Handler) ServeChanges(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "since must be an RFC3339 timestamp")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	key := StateKey(userID)
+	st, err := LoadState(r.Context(), client, key)
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	tombstones, err := TombstonesSince(r.Context(), client, key, since)
+	if err != nil {
+		WriteKVError(w, err)
+		return
+	}
+
+	// Items written before updatedAt was tracked have none; they are sent
+	// every time until they next change, which is safe if wasteful.
+	changed := func(items []map[string]any) []map[string]any {
+		out := []map[string]any{}
+		for _, it := range items {
+			s, _ := it["updatedAt"].(string)
+			if at, err := time.Parse(time.RFC3339Nano, s); err == nil && !at.After(since) {
+				continue
+			}
+			out = append(out, it)
+		}
+		return out
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"since":      since.UTC().Format(time.RFC3339Nano),
+		"revision":   st.Revision,
+		"updated_at": st.UpdatedAt,
+		"courses":    changed(st.Courses),
+		"tasks":      changed(st.Tasks),
+		"grades":     changed(st.Grades),
+		"tombstones": tombstones,
+	})
+}
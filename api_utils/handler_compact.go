@@ -0,0 +1,49 @@
+package api_utils
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ServeCompact serves /api/compact: it deletes leftovers whose TTL was lost
+// and reports how many keys of each kind went. Admin only.
+func (h *Handler) ServeCompact(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Compaction scans every planner's keys, so like metrics it is an
+	// operator tool and stays closed when no API key is configured.
+	if strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		WriteError(w, http.StatusForbidden, CodeForbidden, "compact requires PLANNER_API_KEY")
+		return
+	}
+	if !AuthorizeAdmin(w, r) {
+		return
+	}
+	if ReadOnly() {
+		WriteStateError(w, ErrReadOnly)
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	rep, err := Compact(r.Context(), client, Now())
+	if err != nil {
+		WriteKVError(w, err)
+		return
+	}
+	LoggerFrom(r.Context()).Info("compacted store", "removed", rep.Total, "snapshots", rep.Snapshots)
+	WriteJSON(w, http.StatusOK, rep)
+}
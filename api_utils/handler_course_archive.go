@@ -0,0 +1,60 @@
+package api_utils
+
+import (
+	"net/http"
+)
+
+// ServeCourseArchive archives the course ?id= on POST and unarchives it on
+// DELETE. Archiving only flags the course: it and its tasks and grades
+// stay in the planner and come back unchanged when it is unarchived.
+func (h *Handler) ServeCourseArchive(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "id is required")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	archive := r.Method == http.MethodPost
+	var course map[string]any
+	_, err = MutateState(r.Context(), client, StateKey(userID), func(st *AppState) error {
+		// Deleted courses are hidden everywhere else, so they can't be
+		// archived either.
+		i := IndexByID(st.Courses, id)
+		if i < 0 || IsDeleted(st.Courses[i]) {
+			return ErrCourseNotFound
+		}
+		if archive {
+			st.Courses[i]["archived"] = true
+		} else {
+			delete(st.Courses[i], "archived")
+		}
+		course = st.Courses[i]
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, course)
+}
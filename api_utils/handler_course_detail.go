@@ -0,0 +1,67 @@
+package api_utils
+
+import (
+	"net/http"
+)
+
+// ServeCourseDetail serves /api/course_detail: one course with its tasks and
+// grades.
+func (h *Handler) ServeCourseDetail(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "id is required")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	// A deleted course is hidden like it is from /api/courses, and so are
+	// deleted tasks and grades.
+	i := IndexByID(st.Courses, id)
+	if i < 0 || IsDeleted(st.Courses[i]) {
+		WriteStateError(w, ErrCourseNotFound)
+		return
+	}
+	tasks := []map[string]any{}
+	for _, t := range st.Tasks {
+		if ItemCourseID(t) == id && !IsDeleted(t) {
+			tasks = append(tasks, t)
+		}
+	}
+	grades := []map[string]any{}
+	for _, g := range st.Grades {
+		if ItemCourseID(g) == id && !IsDeleted(g) {
+			grades = append(grades, g)
+		}
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"course": st.Courses[i],
+		"tasks":  tasks,
+		"grades": grades,
+	})
+}
@@ -0,0 +1,146 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ServeCourses serves /api/courses: list, create, merge-patch and
+// soft-delete courses.
+func (h *Handler) ServeCourses(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	key := StateKey(userID)
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		st, err := LoadState(r.Context(), client, key)
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		// Deleted and archived courses are hidden unless asked for.
+		q := r.URL.Query()
+		includeDeleted, _ := strconv.ParseBool(q.Get("includeDeleted"))
+		includeArchived, _ := strconv.ParseBool(q.Get("includeArchived"))
+		courses := []map[string]any{}
+		for _, c := range st.Courses {
+			if (includeDeleted || !IsDeleted(c)) && (includeArchived || !IsArchived(c)) {
+				courses = append(courses, c)
+			}
+		}
+		WriteJSON(w, http.StatusOK, map[string]any{"courses": courses})
+		return
+
+	case http.MethodPost:
+		course, ok := readCourse(w, r)
+		if !ok {
+			return
+		}
+		course["id"] = NewID()
+		_, err := MutateState(r.Context(), client, key, func(st *AppState) error {
+			st.Courses = append(st.Courses, course)
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusCreated, course)
+		return
+
+	case http.MethodPatch:
+		id := r.URL.Query().Get("id")
+		patch, ok := readCourse(w, r)
+		if !ok {
+			return
+		}
+		var updated map[string]any
+		_, err := MutateState(r.Context(), client, key, func(st *AppState) error {
+			i := IndexByID(st.Courses, id)
+			if i < 0 {
+				return ErrCourseNotFound
+			}
+			// The body is a JSON merge patch: nested objects merge and null
+			// removes a key. The id can't be changed or removed. Only this
+			// course is checked here, so errors point into the patch.
+			delete(patch, "id")
+			st.Courses[i], _ = MergePatch(st.Courses[i], patch).(map[string]any)
+			if errs := ValidateCourse(st.Courses[i]); len(errs) > 0 {
+				return &ValidationError{Errors: errs}
+			}
+			updated = st.Courses[i]
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, updated)
+		return
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		var removed map[string]any
+		_, err := MutateState(r.Context(), client, key, func(st *AppState) error {
+			i := IndexByID(st.Courses, id)
+			if i < 0 {
+				return ErrCourseNotFound
+			}
+			// Deleting only marks the course, so it can be restored by
+			// clearing deletedAt; Purge removes it for good later. Tasks
+			// and grades keep their courseId until then.
+			if !IsDeleted(st.Courses[i]) {
+				st.Courses[i]["deletedAt"] = Now().UTC().Format(time.RFC3339)
+			}
+			removed = st.Courses[i]
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, removed)
+		return
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readCourse decodes a course object from the request body, writing a 400
+// and returning ok=false when it isn't one.
+func readCourse(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	body, err := ReadBodyLimit(r, MaxBodyBytes)
+	if err == nil {
+		err = CheckJSONShape(body)
+	}
+	if err != nil {
+		WriteBodyError(w, err)
+		return nil, false
+	}
+	var course map[string]any
+	if err := json.Unmarshal(body, &course); err != nil || course == nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid JSON")
+		return nil, false
+	}
+	return course, true
+}
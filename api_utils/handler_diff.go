@@ -0,0 +1,86 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// ServeDiff serves /api/diff: what changed between two snapshots, or a
+// snapshot and the current planner.
+func (h *Handler) ServeDiff(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "from is required")
+		return
+	}
+	if to == "" {
+		to = "current"
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	key := StateKey(userID)
+	a, err := stateAt(r.Context(), client, key, from)
+	if err != nil {
+		writeDiffError(w, err)
+		return
+	}
+	b, err := stateAt(r.Context(), client, key, to)
+	if err != nil {
+		writeDiffError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"from": from,
+		"to":   to,
+		"diff": DiffState(a, b),
+	})
+}
+
+func writeDiffError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSnapshotNotFound) {
+		WriteError(w, http.StatusNotFound, CodeNotFound, err.Error())
+		return
+	}
+	WriteStateError(w, err)
+}
+
+// stateAt returns the planner as of snapshot id, or as stored now when id
+// is "current". Snapshots go through the same migration and normalization
+// as live state so the two compare cleanly.
+func stateAt(ctx context.Context, c KV, key, id string) (AppState, error) {
+	if id == "current" {
+		return LoadState(ctx, c, key)
+	}
+	snap, found, err := FindSnapshot(ctx, c, key, id)
+	if err != nil {
+		return AppState{}, err
+	}
+	if !found {
+		return AppState{}, errSnapshotNotFound
+	}
+	return SnapshotState(snap)
+}
@@ -0,0 +1,126 @@
+package api_utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const eventsHeartbeat = 15 * time.Second
+
+// ServeEvents serves /api/events, a Server-Sent Events stream that sends
+// the planner whenever it changes.
+func (h *Handler) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	key := StateKey(userID)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, http.StatusInternalServerError, CodeInternal, "streaming unsupported")
+		return
+	}
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	updates, err := client.Subscribe(ctx, StateChannel(key))
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		WriteKVError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	var lastETag string
+	send := func(body []byte) {
+		etag := StateETag(body)
+		if etag == lastETag {
+			return
+		}
+		lastETag = etag
+		fmt.Fprint(w, "event: state\n")
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		fmt.Fprint(w, "\n")
+		flusher.Flush()
+	}
+	sendCurrent := func() {
+		readCtx, cancel := context.WithTimeout(ctx, HandlerTimeout())
+		defer cancel()
+		body, err := ReadStateBlob(readCtx, client, key)
+		if err != nil {
+			if ctx.Err() == nil {
+				LoggerFrom(r.Context()).Warn("events read failed", "key", key, "error", err.Error())
+			}
+			return
+		}
+		send(body)
+	}
+
+	// Without a subscription (Upstash REST) we poll for changes instead.
+	var poll <-chan time.Time
+	if updates == nil {
+		t := time.NewTicker(eventsPollInterval())
+		defer t.Stop()
+		poll = t.C
+	}
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	sendCurrent()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-poll:
+			sendCurrent()
+		case msg, ok := <-updates:
+			if !ok {
+				return
+			}
+			send(msg)
+		}
+	}
+}
+
+// eventsPollInterval returns PLANNER_EVENTS_POLL (default 3s), how often
+// the stream checks for changes when the store cannot push them.
+func eventsPollInterval() time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("PLANNER_EVENTS_POLL")))
+	if err != nil || d < 500*time.Millisecond {
+		return 3 * time.Second
+	}
+	return d
+}
@@ -0,0 +1,70 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ServeExport serves /api/export: the planner as a downloadable backup,
+// with Range support for resuming.
+func (h *Handler) ServeExport(w http.ResponseWriter, r *http.Request) {
+	// Byte ranges refer to the uncompressed backup, so a resumed download
+	// is served as-is rather than gzipped.
+	if r.Header.Get("Range") == "" {
+		var done func()
+		w, done = MaybeGzip(w, r)
+		defer done()
+	}
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID, Range, If-Range")
+	w.Header().Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, ETag, Last-Modified")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	body, err := ReadStateBlob(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteKVError(w, err)
+		return
+	}
+
+	var meta struct {
+		UpdatedAt string `json:"updated_at"`
+	}
+	_ = json.Unmarshal(body, &meta)
+	modtime, _ := time.Parse(time.RFC3339Nano, meta.UpdatedAt)
+
+	media := NegotiateMedia(r.Header.Get("Accept"))
+	w.Header().Add("Vary", "Accept")
+	if body, err = EncodeAs(media, body); err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeInternal, "encoding backup: "+err.Error())
+		return
+	}
+	name := "planner-backup" + MediaExtensions[media]
+
+	// ServeContent handles Range, If-Range and the conditional headers; the
+	// ETag and updated_at let a client resume only if nothing changed.
+	w.Header().Set("Content-Type", media+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("ETag", StateETag(body))
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, name, modtime, bytes.NewReader(body))
+}
@@ -0,0 +1,51 @@
+package api_utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ServeGPA serves /api/gpa: the weighted GPA overall and per course.
+func (h *Handler) ServeGPA(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	scale := 4.0
+	if s := r.URL.Query().Get("scale"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || (f != 4 && f != 100) {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "scale must be 4.0 or 100")
+			return
+		}
+		scale = f
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	if exclude, _ := strconv.ParseBool(r.URL.Query().Get("excludeArchived")); exclude {
+		st = WithoutArchived(st)
+	}
+	WriteJSON(w, http.StatusOK, ComputeGPA(st, scale))
+}
@@ -0,0 +1,95 @@
+package api_utils
+
+import (
+	"encoding/csv"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ServeGradesCSV serves /api/grades_csv: the grade book as CSV.
+func (h *Handler) ServeGradesCSV(w http.ResponseWriter, r *http.Request) {
+	w, done := MaybeGzip(w, r)
+	defer done()
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	courseID := r.URL.Query().Get("courseId")
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	courseNames := map[string]string{}
+	for _, c := range st.Courses {
+		id, _ := c["id"].(string)
+		name, _ := c["name"].(string)
+		courseNames[id] = name
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="grades.csv"`)
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"course", "title", "score", "weight", "date"})
+	for _, g := range st.Grades {
+		cid := ItemCourseID(g)
+		if courseID != "" && cid != courseID {
+			continue
+		}
+		course := courseNames[cid]
+		if course == "" {
+			course = cid
+		}
+		score := ""
+		if pct, ok := GradePercent(g); ok {
+			score = formatNumber(math.Round(pct*100) / 100)
+		}
+		weight := ""
+		if f, ok := g["weight"].(float64); ok {
+			weight = formatNumber(f)
+		}
+		_ = cw.Write([]string{
+			course,
+			firstString(g, "name", "title"),
+			score,
+			weight,
+			firstString(g, "dueISO", "date", "createdISO"),
+		})
+	}
+	cw.Flush()
+}
+
+// firstString returns the first of fields that holds a string in m.
+func firstString(m map[string]any, fields ...string) string {
+	for _, f := range fields {
+		if s, ok := m[f].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
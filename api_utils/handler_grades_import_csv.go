@@ -0,0 +1,259 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gradeCSVColumns are the columns a grade CSV must have, the same ones
+// /api/grades_csv writes, so an export can be imported again.
+var gradeCSVColumns = []string{"course", "title", "score", "weight", "date"}
+
+var errNoGradesImported = errors.New("no grades imported")
+
+// gradeCSVRow is one data row, by column name, with its line in the file.
+type gradeCSVRow struct {
+	line   int
+	fields map[string]string
+}
+
+type skippedGradeRow struct {
+	Row    int    `json:"row"`
+	Reason string `json:"reason"`
+}
+
+// ServeGradesImportCSV serves /api/grades_import_csv: it adds grades from an
+// uploaded CSV, skipping bad rows.
+func (h *Handler) ServeGradesImportCSV(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// Like /api/import, a browser can upload the file as multipart under
+	// "file"; otherwise the body is the CSV itself.
+	var body []byte
+	var err error
+	if IsMultipart(r) {
+		body, _, err = ReadUpload(r, "file", MaxBodyBytes)
+	} else {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mt != "text/csv" && mt != "application/csv" {
+			WriteError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "send the grades as text/csv")
+			return
+		}
+		body, err = ReadBodyLimit(r, MaxBodyBytes)
+	}
+	if errors.Is(err, ErrNoUploadedFile) {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, `multipart upload needs a "file" part`)
+		return
+	}
+	if err != nil {
+		WriteBodyError(w, err)
+		return
+	}
+
+	rows, err := readGradeCSV(body)
+	if err != nil {
+		if errors.Is(err, ErrBodyTooComplex) {
+			WriteBodyError(w, err)
+			return
+		}
+		WriteError(w, http.StatusBadRequest, CodeInvalidCSV, err.Error())
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	var grades []map[string]any
+	var skipped []skippedGradeRow
+	st, err := MutateState(r.Context(), client, StateKey(userID), func(st *AppState) error {
+		grades, skipped = []map[string]any{}, []skippedGradeRow{}
+		courses := map[string][]string{}
+		for _, c := range st.Courses {
+			id, _ := c["id"].(string)
+			name, _ := c["name"].(string)
+			if id != "" && !IsDeleted(c) {
+				k := strings.ToLower(strings.TrimSpace(name))
+				courses[k] = append(courses[k], id)
+			}
+		}
+		for _, row := range rows {
+			g, reason := gradeFromCSV(row.fields, courses)
+			if reason != "" {
+				skipped = append(skipped, skippedGradeRow{Row: row.line, Reason: reason})
+				continue
+			}
+			g["id"] = NewID()
+			grades = append(grades, g)
+		}
+		if len(grades) == 0 {
+			return errNoGradesImported
+		}
+		st.Grades = append(st.Grades, grades...)
+		return nil
+	})
+	resp := map[string]any{"imported": len(grades), "skipped": skipped, "grades": grades}
+	if errors.Is(err, errNoGradesImported) {
+		// Nothing to write, so the planner and its revision stay as they
+		// are.
+		WriteJSON(w, http.StatusOK, resp)
+		return
+	}
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	resp["revision"] = st.Revision
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// readGradeCSV parses a grade CSV. The header must name each of
+// gradeCSVColumns once, in any order and case, and nothing else; a bad
+// header or a syntax error anywhere rejects the whole file. Rows with the
+// wrong number of fields are kept with no fields, to be reported as
+// skipped.
+func readGradeCSV(body []byte) ([]gradeCSVRow, error) {
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV is empty; the first row must be the header " + strings.Join(gradeCSVColumns, ","))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	cols := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		known := false
+		for _, c := range gradeCSVColumns {
+			known = known || c == h
+		}
+		if !known || seen[h] {
+			return nil, fmt.Errorf("malformed header: column %q is unknown or repeated; expected %s", h, strings.Join(gradeCSVColumns, ","))
+		}
+		seen[h] = true
+		cols[i] = h
+	}
+	if len(seen) != len(gradeCSVColumns) {
+		return nil, fmt.Errorf("malformed header: expected columns %s", strings.Join(gradeCSVColumns, ","))
+	}
+
+	var rows []gradeCSVRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(rows) == MaxItems() {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrBodyTooComplex, MaxItems())
+		}
+		line, _ := cr.FieldPos(0)
+		row := gradeCSVRow{line: line}
+		if len(rec) == len(cols) {
+			row.fields = map[string]string{}
+			for i, v := range rec {
+				row.fields[cols[i]] = strings.TrimSpace(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// gradeFromCSV builds a grade from one row, or says why it was skipped.
+// courses maps lower-cased course names to the ids of courses with that
+// name. A score is a percentage ("88" or "88%") or earned/total ("45/50").
+func gradeFromCSV(fields map[string]string, courses map[string][]string) (map[string]any, string) {
+	if fields == nil {
+		return nil, fmt.Sprintf("expected %d fields", len(gradeCSVColumns))
+	}
+	name := fields["course"]
+	ids := courses[strings.ToLower(name)]
+	switch {
+	case name == "":
+		return nil, "course is empty"
+	case len(ids) == 0:
+		return nil, fmt.Sprintf("no course named %q", name)
+	case len(ids) > 1:
+		return nil, fmt.Sprintf("%d courses are named %q", len(ids), name)
+	}
+	if fields["title"] == "" {
+		return nil, "title is empty"
+	}
+	earned, total, ok := parseCSVScore(fields["score"])
+	if !ok {
+		return nil, fmt.Sprintf("score %q is not a percentage or earned/total", fields["score"])
+	}
+	g := map[string]any{
+		"courseId":    ids[0],
+		"name":        fields["title"],
+		"scoreEarned": earned,
+		"scoreTotal":  total,
+	}
+	if s := fields["weight"]; s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || !(f > 0) || math.IsInf(f, 0) {
+			return nil, fmt.Sprintf("weight %q is not a positive number", s)
+		}
+		g["weight"] = f
+	}
+	if s := fields["date"]; s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return nil, fmt.Sprintf("date %q is not YYYY-MM-DD or RFC3339", s)
+			}
+		}
+		g["dueISO"] = t.UTC().Format(time.RFC3339)
+	}
+	return g, ""
+}
+
+func parseCSVScore(s string) (earned, total float64, ok bool) {
+	num, den, frac := strings.Cut(s, "/")
+	total = 100
+	if frac {
+		t, err := strconv.ParseFloat(strings.TrimSpace(den), 64)
+		if err != nil || !(t > 0) || math.IsInf(t, 0) {
+			return 0, 0, false
+		}
+		total = t
+	} else {
+		num = strings.TrimSuffix(num, "%")
+	}
+	earned, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || !(earned >= 0) || math.IsInf(earned, 0) {
+		return 0, 0, false
+	}
+	return earned, total, true
+}
@@ -0,0 +1,112 @@
+package api_utils
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServeICS serves /api/ics: tasks with due dates as an iCalendar feed.
+func (h *Handler) ServeICS(w http.ResponseWriter, r *http.Request) {
+	w, done := MaybeGzip(w, r)
+	defer done()
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="planner.ics"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(buildCalendar(st, Now().UTC())))
+}
+
+// buildCalendar renders one VEVENT per task that has a title and a
+// parseable due date.
+func buildCalendar(st AppState, now time.Time) string {
+	courseNames := map[string]string{}
+	for _, c := range st.Courses {
+		id, _ := c["id"].(string)
+		name, _ := c["name"].(string)
+		courseNames[id] = name
+	}
+
+	var b strings.Builder
+	line := func(s string) { writeICSLine(&b, s) }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//School Planner//Tasks//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:School Planner")
+	stamp := now.Format("20060102T150405Z")
+	for _, t := range st.Tasks {
+		title, _ := t["title"].(string)
+		due, ok := TaskDue(t)
+		if title == "" || !ok {
+			continue
+		}
+		id, _ := t["id"].(string)
+		summary := title
+		if name := courseNames[ItemCourseID(t)]; name != "" {
+			summary = "[" + name + "] " + title
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeICSText(id) + "@school-planner")
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + due.UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + escapeICSText(summary))
+		if notes, _ := t["notes"].(string); notes != "" {
+			line("DESCRIPTION:" + escapeICSText(notes))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeICSText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// writeICSLine writes s as a CRLF-terminated content line, folded at 75
+// octets without splitting UTF-8 sequences (RFC 5545 section 3.1).
+func writeICSLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,110 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ServeImport serves /api/import: it replaces the planner with an uploaded
+// backup.
+func (h *Handler) ServeImport(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID, X-Schema-Version")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	schema, err := ParseSchemaVersion(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeUnsupportedSchema, err.Error())
+		return
+	}
+
+	// Browsers upload a picked file as multipart/form-data under "file";
+	// scripts send the backup as the raw body. Backups exported as YAML or
+	// TOML come back in the same form either way.
+	var body []byte
+	var media string
+	if IsMultipart(r) {
+		body, media, err = ReadUpload(r, "file", MaxBodyBytes)
+	} else {
+		body, err = ReadBodyLimit(r, MaxBodyBytes)
+		media = RequestMedia(r.Header.Get("Content-Type"))
+	}
+	if errors.Is(err, ErrNoUploadedFile) {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, `multipart upload needs a "file" part`)
+		return
+	}
+	if err != nil {
+		WriteBodyError(w, err)
+		return
+	}
+	if body, err = DecodeFrom(media, body); err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid backup: "+err.Error())
+		return
+	}
+	if err := CheckJSONShape(body); err != nil {
+		WriteBodyError(w, err)
+		return
+	}
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(body, &head); err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid JSON")
+		return
+	}
+	if head.Version > SchemaVersion {
+		WriteError(w, http.StatusBadRequest, CodeUnsupportedSchema, fmt.Sprintf("backup is schema version %d; this server supports up to %d", head.Version, SchemaVersion))
+		return
+	}
+	// An older backup is upgraded the way PUT /api/state upgrades a body:
+	// from X-Schema-Version when sent, else from the backup's own version
+	// (none means 1, as for a stored blob).
+	var in AppState
+	if schema < SchemaVersion {
+		in, err = MigrateFrom(body, schema)
+	} else {
+		in, _, err = Migrate(body)
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	// An import replaces the planner wholesale; the previous state is kept
+	// as a snapshot by MutateState.
+	st, err := MutateState(r.Context(), client, StateKey(userID), func(cur *AppState) error {
+		*cur = in
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"ok":       true,
+		"revision": st.Revision,
+		"version":  st.Version,
+		"courses":  len(st.Courses),
+		"tasks":    len(st.Tasks),
+		"grades":   len(st.Grades),
+	})
+}
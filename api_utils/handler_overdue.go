@@ -0,0 +1,69 @@
+package api_utils
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ServeOverdue serves /api/overdue: unfinished tasks past their due date.
+func (h *Handler) ServeOverdue(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	now := Now()
+	if s := r.URL.Query().Get("asOf"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "asOf must be an RFC3339 timestamp")
+			return
+		}
+		now = t
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	// Tasks without a usable due date can't be late, so they are left out.
+	tasks := []map[string]any{}
+	for _, t := range st.Tasks {
+		if IsDeleted(t) || TaskDone(t) {
+			continue
+		}
+		if due, ok := TaskDue(t); ok && due.Before(now) {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, _ := TaskDue(tasks[i])
+		b, _ := TaskDue(tasks[j])
+		return a.Before(b)
+	})
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"asOf":  now.UTC().Format(time.RFC3339),
+		"count": len(tasks),
+		"tasks": tasks,
+	})
+}
@@ -0,0 +1,61 @@
+package api_utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// defaultPurgeDays is how long soft-deleted items are kept when /api/purge is
+// called without ?olderThanDays.
+const defaultPurgeDays = 30
+
+// ServePurge serves /api/purge: it permanently removes items soft-deleted
+// more than ?olderThanDays= ago.
+func (h *Handler) ServePurge(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	days := defaultPurgeDays
+	if s := r.URL.Query().Get("olderThanDays"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "olderThanDays must be a non-negative integer")
+			return
+		}
+		days = n
+	}
+	cutoff := Now().UTC().AddDate(0, 0, -days)
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	purged := 0
+	st, err := MutateState(r.Context(), client, StateKey(userID), func(st *AppState) error {
+		purged = PurgeDeleted(st, cutoff)
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"purged":   purged,
+		"revision": st.Revision,
+	})
+}
@@ -0,0 +1,110 @@
+package api_utils
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	defaultReminderWindow = 24 * time.Hour
+	maxReminderWindow     = 31 * 24 * time.Hour
+)
+
+// ServeReminders serves /api/reminders: unfinished tasks whose reminder falls
+// within ?within=.
+func (h *Handler) ServeReminders(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	within := defaultReminderWindow
+	if s := r.URL.Query().Get("within"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxReminderWindow {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "within must be a positive duration up to 744h, e.g. 24h")
+			return
+		}
+		within = d
+	}
+	now := Now()
+	if s := r.URL.Query().Get("asOf"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "asOf must be an RFC3339 timestamp")
+			return
+		}
+		now = t
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	// A task is listed when its reminder, reminderLeadMinutes before it is
+	// due, falls within the window. Tasks already past due belong to
+	// /api/overdue instead.
+	type reminder struct {
+		task map[string]any
+		due  time.Time
+		at   time.Time
+	}
+	var found []reminder
+	end := now.Add(within)
+	for _, t := range st.Tasks {
+		if IsDeleted(t) || TaskDone(t) {
+			continue
+		}
+		due, ok := TaskDue(t)
+		if !ok || !due.After(now) {
+			continue
+		}
+		lead, _ := TaskReminderLead(t)
+		if at := due.Add(-lead); !at.After(end) {
+			found = append(found, reminder{task: t, due: due, at: at})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].due.Before(found[j].due) })
+
+	reminders := make([]map[string]any, 0, len(found))
+	for _, f := range found {
+		remindAt := f.at
+		if remindAt.Before(now) {
+			// The lead time has already started; remind right away.
+			remindAt = now
+		}
+		reminders = append(reminders, map[string]any{
+			"task":            f.task,
+			"due":             f.due.UTC().Format(time.RFC3339),
+			"remindAt":        remindAt.UTC().Format(time.RFC3339),
+			"minutesUntilDue": int(math.Ceil(f.due.Sub(now).Minutes())),
+		})
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"asOf":      now.UTC().Format(time.RFC3339),
+		"within":    within.String(),
+		"count":     len(reminders),
+		"reminders": reminders,
+	})
+}
@@ -0,0 +1,66 @@
+package api_utils
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ServeReset serves /api/reset: it replaces the planner with the default
+// state, or with ?hard=true deletes it outright.
+func (h *Handler) ServeReset(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Resetting wipes a planner, so it is off unless explicitly enabled
+	// and never available without an API key.
+	if os.Getenv("PLANNER_ALLOW_RESET") != "1" {
+		WriteError(w, http.StatusForbidden, CodeForbidden, "reset is disabled; set PLANNER_ALLOW_RESET=1")
+		return
+	}
+	if strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		WriteError(w, http.StatusForbidden, CodeForbidden, "reset requires PLANNER_API_KEY")
+		return
+	}
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	key := StateKey(userID)
+
+	// A hard reset removes the planner and everything kept alongside it
+	// outright; reads then fall back to the default state.
+	if hard, _ := strconv.ParseBool(r.URL.Query().Get("hard")); hard {
+		if err := DeleteState(r.Context(), client, key); err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, DefaultState())
+		return
+	}
+
+	st, err := MutateState(r.Context(), client, key, func(cur *AppState) error {
+		*cur = DefaultState()
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,98 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeSettings serves /api/settings: read, replace, merge-patch or reset
+// just the settings.
+func (h *Handler) ServeSettings(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, PATCH, DELETE, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	key := StateKey(userID)
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		st, err := LoadState(r.Context(), client, key)
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, st.Settings)
+		return
+
+	case http.MethodPut, http.MethodPatch:
+		body, err := ReadBodyLimit(r, MaxBodyBytes)
+		if err == nil {
+			err = CheckJSONShape(body)
+		}
+		if err != nil {
+			WriteBodyError(w, err)
+			return
+		}
+		var in map[string]any
+		if err := json.Unmarshal(body, &in); err != nil || in == nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid JSON")
+			return
+		}
+		// PUT sets the given keys as they are; PATCH is a merge patch, so
+		// nested objects merge and null removes a key. Either way keys not
+		// mentioned are kept, and MutateState re-normalizes the result.
+		st, err := MutateState(r.Context(), client, key, func(st *AppState) error {
+			if r.Method == http.MethodPatch {
+				st.Settings, _ = MergePatch(st.Settings, in).(map[string]any)
+				return nil
+			}
+			for k, v := range in {
+				st.Settings[k] = v
+			}
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, st.Settings)
+		return
+
+	case http.MethodDelete:
+		// ?key= resets one setting, anything else resets them all. Known
+		// settings come back with their defaults through normalization;
+		// other keys are simply gone.
+		name := r.URL.Query().Get("key")
+		st, err := MutateState(r.Context(), client, key, func(st *AppState) error {
+			if name != "" {
+				delete(st.Settings, name)
+				return nil
+			}
+			st.Settings = DefaultState().Settings
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, st.Settings)
+		return
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
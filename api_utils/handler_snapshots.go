@@ -0,0 +1,78 @@
+package api_utils
+
+import (
+	"net/http"
+)
+
+// ServeSnapshots serves /api/snapshots: list previous versions of the
+// planner, or restore one.
+func (h *Handler) ServeSnapshots(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	key := StateKey(userID)
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		snaps, err := ListSnapshots(r.Context(), client, key)
+		if err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		list := make([]map[string]any, 0, len(snaps))
+		for _, s := range snaps {
+			list = append(list, map[string]any{"id": s.ID, "savedAt": s.SavedAt})
+		}
+		WriteJSON(w, http.StatusOK, map[string]any{"snapshots": list})
+		return
+
+	case http.MethodPost:
+		id := r.URL.Query().Get("id")
+		snap, found, err := FindSnapshot(r.Context(), client, key, id)
+		if err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		if !found {
+			WriteError(w, http.StatusNotFound, CodeNotFound, "snapshot not found")
+			return
+		}
+		// Snapshots keep the schema they were saved in, so they are migrated
+		// like a stored state before they replace it.
+		restored, err := SnapshotState(snap)
+		if err != nil {
+			WriteError(w, http.StatusUnprocessableEntity, CodeStateCorrupt, "snapshot is not a valid state: "+err.Error())
+			return
+		}
+		// The restore is itself a write, so the state it replaces becomes
+		// a snapshot too and the restore can be undone.
+		st, err := MutateState(r.Context(), client, key, func(cur *AppState) error {
+			*cur = restored
+			return nil
+		})
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, st)
+		return
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
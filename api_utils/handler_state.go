@@ -0,0 +1,422 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ServeState serves /api/state: GET/HEAD read the planner (as JSON, or
+// YAML or TOML per Accept), PUT replaces it, PATCH merge-patches it.
+func (h *Handler) ServeState(w http.ResponseWriter, r *http.Request) {
+	w, done := MaybeGzip(w, r)
+	defer done()
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID, X-Force-Write, If-None-Match, If-Match, X-Schema-Version, Idempotency-Key, X-Dry-Run, X-Signature")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Schema-Version, X-State-Version, X-State-Revision, X-Stale")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, PUT, PATCH, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	key := StateKey(userID)
+
+	// Older clients can ask for, and send, the state in the schema they
+	// understand; the stored copy always stays at SchemaVersion.
+	schema, err := ParseSchemaVersion(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeUnsupportedSchema, err.Error())
+		return
+	}
+	w.Header().Set("X-Schema-Version", strconv.Itoa(schema))
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		body, stale, err := ReadStateBlobOrStale(r.Context(), client, key)
+		if err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		if stale {
+			// Writes will fail until the store is back; the client can
+			// show the planner read-only.
+			w.Header().Set("X-Stale", "true")
+		} else {
+			RefreshStateTTL(r.Context(), client, key)
+		}
+		if body, err = Downgrade(body, schema); err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		// ?fields=courses,grades trims the planner to the sections a
+		// focused view needs; the ETag then covers only those.
+		if fields, err := stateFields(r.URL.Query().Get("fields")); err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		} else if fields != nil {
+			if body, err = selectFields(body, fields); err != nil {
+				WriteKVError(w, err)
+				return
+			}
+		}
+		var meta struct {
+			Version  int `json:"version"`
+			Revision int `json:"revision"`
+		}
+		_ = json.Unmarshal(body, &meta)
+		// The planner can also be read as YAML or TOML; each representation
+		// gets its own ETag.
+		media := NegotiateMedia(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+		if body, err = EncodeAs(media, body); err != nil {
+			WriteError(w, http.StatusInternalServerError, CodeInternal, "encoding state: "+err.Error())
+			return
+		}
+		etag := StateETag(body)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-State-Version", strconv.Itoa(meta.Version))
+		w.Header().Set("X-State-Revision", strconv.Itoa(meta.Revision))
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", media+"; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		// HEAD is a cheap change check: same headers as GET, no body.
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(body)
+		}
+		return
+
+	case http.MethodPut:
+		body, err := ReadBodyLimit(r, MaxBodyBytes)
+		if err != nil {
+			WriteBodyError(w, err)
+			return
+		}
+		// With PLANNER_HMAC_SECRET set, only a gateway holding the secret
+		// can replace the planner; the signature covers the bytes as sent.
+		if err := VerifySignature(r, body); err != nil {
+			WriteError(w, http.StatusUnauthorized, CodeInvalidSignature, err.Error())
+			return
+		}
+		if err := CheckJSONShape(body); err != nil {
+			WriteBodyError(w, err)
+			return
+		}
+
+		// A retried save with the same Idempotency-Key gets the original
+		// response back instead of being applied a second time.
+		dry := dryRun(r)
+		idemKey := ""
+		if !dry {
+			idemKey = IdempotencyKey(r, key)
+		}
+		if idemKey != "" {
+			prev, found, err := LoadIdempotent(r.Context(), client, idemKey)
+			if err != nil {
+				WriteKVError(w, err)
+				return
+			}
+			if found {
+				if prev.RequestHash != RequestHash(body) {
+					WriteError(w, http.StatusUnprocessableEntity, CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request body")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(prev.Status)
+				_, _ = w.Write(prev.Body)
+				return
+			}
+		}
+
+		// ?strict=true rejects top-level fields this server doesn't know
+		// instead of silently dropping them.
+		var in AppState
+		if schema < SchemaVersion {
+			in, err = MigrateFrom(body, schema)
+		} else if strict(r) {
+			in, err = decodeStrict(body)
+		} else {
+			err = json.Unmarshal(body, &in)
+		}
+		if err != nil {
+			msg := "invalid JSON"
+			if strings.HasPrefix(err.Error(), "json: unknown field") {
+				msg = err.Error()
+			}
+			WriteError(w, http.StatusBadRequest, CodeInvalidJSON, msg)
+			return
+		}
+
+		// Items sent without an id would be unaddressable, so they get one
+		// unless the client manages its own (?assignIds=false).
+		force := forceWrite(r)
+		var assigned map[string][]AssignedID
+		replace := func(cur *AppState) error {
+			if !force && in.Revision != cur.Revision {
+				return &ConflictError{Current: *cur}
+			}
+			*cur = in
+			if assignIDs(r) {
+				assigned = AssignMissingIDs(cur)
+			}
+			return nil
+		}
+
+		if dry {
+			st, err := PreviewState(r.Context(), client, key, replace)
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				WriteJSON(w, http.StatusOK, map[string]any{
+					"dryRun":   true,
+					"valid":    false,
+					"errors":   verr.Errors,
+					"problems": verr.Problems(),
+				})
+				return
+			}
+			if err != nil {
+				WriteStateError(w, err)
+				return
+			}
+			warnings := StateWarnings(st)
+			if warnings == nil {
+				warnings = []string{}
+			}
+			WriteJSON(w, http.StatusOK, map[string]any{
+				"dryRun":      true,
+				"valid":       true,
+				"warnings":    warnings,
+				"assignedIds": assigned,
+				"state":       st,
+			})
+			return
+		}
+
+		// If-Match is the HTTP-native alternative to the revision check:
+		// it must name the ETag of the stored JSON.
+		st, err := MutateStateIfMatch(r.Context(), client, key, r.Header.Get("If-Match"), replace)
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		NotifyStateUpdated(r.Context(), userID, st)
+
+		resp := map[string]any{
+			"ok":         true,
+			"revision":   st.Revision,
+			"updated_at": st.UpdatedAt,
+		}
+		if len(assigned) > 0 {
+			resp["assignedIds"] = assigned
+		}
+		if idemKey != "" {
+			b, _ := json.Marshal(resp)
+			res := IdempotentResult{Status: http.StatusOK, RequestHash: RequestHash(body), Body: b}
+			if err := SaveIdempotent(r.Context(), client, idemKey, res); err != nil {
+				LoggerFrom(r.Context()).Warn("idempotency record failed", "key", idemKey, "error", err.Error())
+			}
+		}
+		WriteJSON(w, http.StatusOK, resp)
+		return
+
+	case http.MethodPatch:
+		if schema != SchemaVersion {
+			WriteError(w, http.StatusBadRequest, CodeUnsupportedSchema, fmt.Sprintf("PATCH requires schema version %d", SchemaVersion))
+			return
+		}
+		body, err := ReadBodyLimit(r, MaxBodyBytes)
+		if err == nil {
+			err = CheckJSONShape(body)
+		}
+		if err != nil {
+			WriteBodyError(w, err)
+			return
+		}
+		var patch map[string]any
+		if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "invalid JSON")
+			return
+		}
+
+		force := forceWrite(r)
+		st, err := MutateState(r.Context(), client, key, func(cur *AppState) error {
+			return applyStatePatch(cur, patch, force)
+		})
+		if err != nil {
+			if errors.Is(err, errBadPatch) {
+				WriteError(w, http.StatusBadRequest, CodeInvalidPatch, err.Error())
+				return
+			}
+			WriteStateError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, st)
+		return
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// stateSections are the top-level fields ?fields= may name.
+var stateSections = []string{"revision", "updated_at", "courses", "tasks", "grades", "settings"}
+
+// stateFields parses a comma-separated ?fields= list. It returns nil when
+// the list is empty, meaning the whole planner.
+func stateFields(list string) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || f == "version" {
+			continue
+		}
+		if !slices.Contains(stateSections, f) {
+			return nil, fmt.Errorf("unknown field %q in fields; use %s", f, strings.Join(stateSections, ", "))
+		}
+		fields = append(fields, f)
+	}
+	if fields == nil && strings.TrimSpace(list) != "" {
+		fields = []string{}
+	}
+	return fields, nil
+}
+
+// selectFields keeps only version and the given top-level fields of a
+// stored state. The kept sections are copied as they are, not decoded.
+func selectFields(body []byte, fields []string) ([]byte, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadStateBlob, err)
+	}
+	out := map[string]json.RawMessage{"version": all["version"]}
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			out[f] = v
+		}
+	}
+	return json.Marshal(out)
+}
+
+var errBadPatch = errors.New("invalid patch")
+
+// applyStatePatch applies a merge patch (RFC 7396) to st. Settings merge
+// deeply; courses, tasks and grades are upserted element by element,
+// matched on id. A revision in the patch is checked like on PUT.
+func applyStatePatch(st *AppState, patch map[string]any, force bool) error {
+	if rev, ok := patch["revision"]; ok && !force {
+		if f, isF := rev.(float64); !isF || int(f) != st.Revision {
+			return &ConflictError{Current: *st}
+		}
+	}
+	for field, v := range patch {
+		var err error
+		switch field {
+		case "version", "revision":
+		case "settings":
+			if v == nil {
+				st.Settings = nil
+				break
+			}
+			settings, ok := MergePatch(st.Settings, v).(map[string]any)
+			if !ok {
+				return fmt.Errorf("%w: settings must be an object", errBadPatch)
+			}
+			st.Settings = settings
+		case "courses":
+			st.Courses, err = UpsertByID(st.Courses, v)
+		case "tasks":
+			st.Tasks, err = UpsertByID(st.Tasks, v)
+		case "grades":
+			st.Grades, err = UpsertByID(st.Grades, v)
+		default:
+			return fmt.Errorf("%w: unknown field %q", errBadPatch, field)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", errBadPatch, field, err)
+		}
+	}
+	return nil
+}
+
+// etagMatches reports whether an If-None-Match style header lists etag.
+// Weak validators compare equal to their strong form, as RFC 9110 requires
+// for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || strings.TrimPrefix(part, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// forceWrite reports whether the client asked to skip the revision check,
+// via ?force=true or an X-Force-Write header, to recover from a conflict.
+func forceWrite(r *http.Request) bool {
+	if v, err := strconv.ParseBool(r.URL.Query().Get("force")); err == nil && v {
+		return true
+	}
+	v, err := strconv.ParseBool(r.Header.Get("X-Force-Write"))
+	return err == nil && v
+}
+
+// dryRun reports whether a write should only be previewed, via
+// ?dryRun=true or an X-Dry-Run header.
+func dryRun(r *http.Request) bool {
+	if v, err := strconv.ParseBool(r.URL.Query().Get("dryRun")); err == nil && v {
+		return true
+	}
+	v, err := strconv.ParseBool(r.Header.Get("X-Dry-Run"))
+	return err == nil && v
+}
+
+// decodeStrict decodes a state body like json.Unmarshal but fails on
+// fields AppState doesn't have.
+func decodeStrict(body []byte) (AppState, error) {
+	var st AppState
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&st); err != nil {
+		return AppState{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return AppState{}, errors.New("invalid JSON: trailing data")
+	}
+	return st, nil
+}
+
+// strict reports whether PUT should reject unknown fields, via
+// ?strict=true.
+func strict(r *http.Request) bool {
+	v, err := strconv.ParseBool(r.URL.Query().Get("strict"))
+	return err == nil && v
+}
+
+// assignIDs reports whether PUT should fill in missing item ids; clients
+// that manage their own ids turn it off with ?assignIds=false.
+func assignIDs(r *http.Request) bool {
+	v, err := strconv.ParseBool(r.URL.Query().Get("assignIds"))
+	return err != nil || v
+}
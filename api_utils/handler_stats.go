@@ -0,0 +1,72 @@
+package api_utils
+
+import (
+	"net/http"
+)
+
+// ServeStats serves /api/stats: the dashboard counts.
+func (h *Handler) ServeStats(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	// Soft-deleted items don't count; the GPA is the same 4.0-scale figure
+	// /api/gpa reports, or 0 before any grade is entered.
+	courses, grades, done, pending := 0, 0, 0, 0
+	for _, c := range st.Courses {
+		if !IsDeleted(c) {
+			courses++
+		}
+	}
+	for _, t := range st.Tasks {
+		switch {
+		case IsDeleted(t):
+		case TaskDone(t):
+			done++
+		default:
+			pending++
+		}
+	}
+	for _, g := range st.Grades {
+		if !IsDeleted(g) {
+			grades++
+		}
+	}
+	gpa := 0.0
+	if rep := ComputeGPA(st, 4); rep.Overall != nil {
+		gpa = *rep.Overall
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"courses":        courses,
+		"tasks":          done + pending,
+		"tasksCompleted": done,
+		"tasksPending":   pending,
+		"grades":         grades,
+		"gpa":            gpa,
+	})
+}
@@ -0,0 +1,110 @@
+package api_utils
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// ServeTaskAttachment serves /api/task_attachment: read, store or delete the
+// file attached to a task.
+func (h *Handler) ServeTaskAttachment(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, PUT, DELETE, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	taskID := r.URL.Query().Get("taskId")
+	if taskID == "" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "taskId is required")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	key := StateKey(userID)
+	akey := AttachmentKey(key, taskID)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		data, contentType, found, err := LoadAttachment(r.Context(), client, akey)
+		if err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		if !found {
+			WriteError(w, http.StatusNotFound, CodeNotFound, "task has no attachment")
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		return
+
+	case http.MethodPut:
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || !AttachmentTypes[contentType] {
+			WriteError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "attachments must be a PDF or a PNG, JPEG, GIF or WebP image")
+			return
+		}
+		data, err := ReadBodyLimit(r, AttachmentMaxBytes())
+		if err != nil {
+			WriteBodyError(w, err)
+			return
+		}
+		if len(data) == 0 {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "attachment is empty")
+			return
+		}
+		if ReadOnly() {
+			WriteStateError(w, ErrReadOnly)
+			return
+		}
+		st, err := LoadState(r.Context(), client, key)
+		if err != nil {
+			WriteStateError(w, err)
+			return
+		}
+		if IndexByID(st.Tasks, taskID) < 0 {
+			WriteError(w, http.StatusNotFound, CodeNotFound, "task not found")
+			return
+		}
+		if err := SaveAttachment(r.Context(), client, akey, contentType, data); err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]any{
+			"taskId":      taskID,
+			"contentType": contentType,
+			"size":        len(data),
+		})
+		return
+
+	case http.MethodDelete:
+		if ReadOnly() {
+			WriteStateError(w, ErrReadOnly)
+			return
+		}
+		if err := DeleteAttachment(r.Context(), client, akey); err != nil {
+			WriteKVError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,69 @@
+package api_utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// ServeTasks serves /api/tasks: tasks, optionally filtered, in display
+// order.
+func (h *Handler) ServeTasks(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	courseID := q.Get("courseId")
+	var dueBefore time.Time
+	if s := q.Get("dueBefore"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "dueBefore must be an RFC3339 timestamp")
+			return
+		}
+		dueBefore = t
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	st, err := LoadState(r.Context(), client, StateKey(userID))
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+
+	tasks := []map[string]any{}
+	for _, t := range st.Tasks {
+		if courseID != "" && ItemCourseID(t) != courseID {
+			continue
+		}
+		if !dueBefore.IsZero() {
+			due, ok := TaskDue(t)
+			if !ok || !due.Before(dueBefore) {
+				continue
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	SortTasks(tasks)
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"tasks": tasks,
+		"count": len(tasks),
+	})
+}
@@ -0,0 +1,104 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxBulkTasks caps how many tasks one /api/tasks_bulk request may add.
+const maxBulkTasks = 200
+
+// ServeTasksBulk serves /api/tasks_bulk: it appends a batch of tasks in one
+// write.
+func (h *Handler) ServeTasksBulk(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ReadBodyLimit(r, MaxBodyBytes)
+	if err == nil {
+		err = CheckJSONShape(body)
+	}
+	if err != nil {
+		WriteBodyError(w, err)
+		return
+	}
+	var tasks []map[string]any
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, "body must be a JSON array of task objects")
+		return
+	}
+	if len(tasks) == 0 {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "no tasks given")
+		return
+	}
+	if len(tasks) > maxBulkTasks {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("at most %d tasks per request", maxBulkTasks))
+		return
+	}
+
+	// The batch is all-or-nothing: every task is checked before any is
+	// stored.
+	// Paths point into the request body, which is the array itself.
+	var errs []FieldError
+	seen := map[string]bool{}
+	for i, t := range tasks {
+		loc, path := fmt.Sprintf("tasks[%d]", i), fmt.Sprintf("/%d", i)
+		if t == nil {
+			errs = append(errs, FieldError{Loc: loc, Path: path, Code: FieldInvalidType, Message: "must be an object"})
+			continue
+		}
+		if id, _ := t["id"].(string); id == "" {
+			t["id"] = NewID()
+		}
+		errs = append(errs, PrefixFieldErrors(ValidateTask(t), loc, path)...)
+		if id, _ := t["id"].(string); seen[id] {
+			errs = append(errs, FieldError{Loc: loc, Path: path + "/id", Code: FieldDuplicate, Message: fmt.Sprintf("duplicate id %q", id)})
+		} else {
+			seen[id] = true
+		}
+	}
+	if len(errs) > 0 {
+		WriteStateError(w, &ValidationError{Errors: errs})
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	_, err = MutateState(r.Context(), client, StateKey(userID), func(st *AppState) error {
+		for i, t := range tasks {
+			if id, _ := t["id"].(string); IndexByID(st.Tasks, id) >= 0 {
+				return &ValidationError{Errors: []FieldError{{
+					Path: fmt.Sprintf("/%d/id", i), Code: FieldDuplicate, Message: fmt.Sprintf("task id %q already exists", id),
+				}}}
+			}
+		}
+		st.Tasks = append(st.Tasks, tasks...)
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusCreated, map[string]any{
+		"tasks": tasks,
+		"count": len(tasks),
+	})
+}
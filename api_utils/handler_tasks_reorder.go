@@ -0,0 +1,104 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeReorderTasks serves /api/tasks_reorder: it saves a drag-and-drop task
+// order.
+func (h *Handler) ServeReorderTasks(w http.ResponseWriter, r *http.Request) {
+	ApplyCORS(w, r)
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-User-ID, X-Request-ID")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ReadBodyLimit(r, MaxBodyBytes)
+	if err == nil {
+		err = CheckJSONShape(body)
+	}
+	if err != nil {
+		WriteBodyError(w, err)
+		return
+	}
+	var in struct {
+		CourseID string   `json:"courseId"`
+		IDs      []string `json:"ids"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, `body must be {"courseId": "...", "ids": ["..."]}`)
+		return
+	}
+	if in.CourseID == "" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "courseId is required")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	ignored := []string{}
+	var tasks []map[string]any
+	st, err := MutateState(r.Context(), client, StateKey(userID), func(st *AppState) error {
+		ignored = ignored[:0]
+		var course []map[string]any
+		for _, t := range st.Tasks {
+			if ItemCourseID(t) == in.CourseID && !IsDeleted(t) {
+				course = append(course, t)
+			}
+		}
+		// The listed tasks come first, in list order; the course's other
+		// tasks keep their current relative order after them. Ids that
+		// are gone or belong elsewhere were likely deleted or moved while
+		// the client was dragging, so they are skipped rather than failing
+		// the whole reorder.
+		SortTasks(course)
+		placed := map[string]bool{}
+		ordered := make([]map[string]any, 0, len(course))
+		for _, id := range in.IDs {
+			i := IndexByID(course, id)
+			if i < 0 || placed[id] {
+				ignored = append(ignored, id)
+				continue
+			}
+			placed[id] = true
+			ordered = append(ordered, course[i])
+		}
+		for _, t := range course {
+			if id, _ := t["id"].(string); !placed[id] {
+				ordered = append(ordered, t)
+			}
+		}
+		for i, t := range ordered {
+			t["order"] = i
+		}
+		tasks = ordered
+		return nil
+	})
+	if err != nil {
+		WriteStateError(w, err)
+		return
+	}
+	if tasks == nil {
+		tasks = []map[string]any{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"tasks":    tasks,
+		"ignored":  ignored,
+		"revision": st.Revision,
+	})
+}
@@ -0,0 +1,102 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerServesFromItsStore(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+	t.Setenv("PLANNER_READONLY", "")
+	mem := NewMemoryKV()
+	h := NewHandler(mem, Config{})
+	req := func(method, body string) *http.Request {
+		r := httptest.NewRequest(method, "/api/courses", strings.NewReader(body))
+		r.Header.Set("X-API-Key", "key")
+		r.Header.Set("X-User-ID", "alice")
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeCourses(w, req(http.MethodPost, `{"name":"Biology"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: code %d: %s", w.Code, w.Body)
+	}
+	st, err := LoadState(context.Background(), mem, StateKey("alice"))
+	if err != nil || len(st.Courses) != 1 {
+		t.Fatalf("stored courses = %v, %v; want the new course", st.Courses, err)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeCourses(w, req(http.MethodGet, ""))
+	var got struct {
+		Courses []map[string]any `json:"courses"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got.Courses) != 1 || got.Courses[0]["name"] != "Biology" {
+		t.Fatalf("GET: %s", w.Body)
+	}
+}
+
+func TestHandlerRateLimitsInItsStore(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+	defer SetClock(func() time.Time { return testNow })()
+	mem := NewMemoryKV()
+	h := NewHandler(mem, Config{RateLimitPerMinute: 1})
+	serve := WithRateLimit(h.ServeTasks, h.KV, h.Config.RateLimitPerMinute)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		r := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+		r.Header.Set("X-API-Key", "key")
+		r.Header.Set("X-User-ID", "alice")
+		w := httptest.NewRecorder()
+		serve(w, r)
+		if w.Code != want {
+			t.Fatalf("request %d: code %d, want %d", i+1, w.Code, want)
+		}
+	}
+	keys, _ := mem.ListKeys(context.Background(), "ratelimit:")
+	if len(keys) == 0 {
+		t.Error("the rate limit wasn't counted in the handler's store")
+	}
+}
+
+func TestImportMigratesOldBackup(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+	t.Setenv("PLANNER_READONLY", "")
+	mem := NewMemoryKV()
+	h := NewHandler(mem, Config{})
+
+	// A schema 1 backup keeps task due dates in "due".
+	backup := `{"version":1,"courses":[],"tasks":[{"id":"t1","title":"Essay","due":"2026-03-05T09:00:00Z"}],"grades":[],"settings":{}}`
+	r := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(backup))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-API-Key", "key")
+	r.Header.Set("X-User-ID", "alice")
+	w := httptest.NewRecorder()
+	h.ServeImport(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d: %s", w.Code, w.Body)
+	}
+
+	st, err := LoadState(context.Background(), mem, StateKey("alice"))
+	if err != nil || len(st.Tasks) != 1 {
+		t.Fatalf("stored tasks = %v, %v", st.Tasks, err)
+	}
+	if st.Version != SchemaVersion {
+		t.Errorf("version = %d, want %d", st.Version, SchemaVersion)
+	}
+	if got := st.Tasks[0]["dueISO"]; got != "2026-03-05T09:00:00Z" {
+		t.Errorf("dueISO = %v; the v1 due date was lost", got)
+	}
+	if _, ok := st.Tasks[0]["due"]; ok {
+		t.Error("the v1 due field was stored as is")
+	}
+}
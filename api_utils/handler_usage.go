@@ -0,0 +1,79 @@
+package api_utils
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxUsageDays caps the date range one /api/usage request may ask for.
+const maxUsageDays = 31
+
+// ServeUsage serves /api/usage: per-user request counts per day. Admin
+// only.
+func (h *Handler) ServeUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Usage shows every user's activity, so like metrics it stays closed
+	// when no API key is configured.
+	if strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		WriteError(w, http.StatusForbidden, CodeForbidden, "usage requires PLANNER_API_KEY")
+		return
+	}
+	if !AuthorizeAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	today := Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if s := q.Get(p.name); s != "" {
+			d, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, CodeInvalidRequest, p.name+" must be a YYYY-MM-DD date")
+				return
+			}
+			*p.dst = d
+		}
+	}
+	if to.Before(from) || to.Sub(from) >= maxUsageDays*24*time.Hour {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, "from..to must be a range of 1 to 31 days")
+		return
+	}
+
+	client, err := h.Store()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, CodeMisconfigured, "server misconfigured: "+err.Error())
+		return
+	}
+	// ?userId=a,b limits the report; without it every user with a counter
+	// still stored is included.
+	var users []string
+	if s := q.Get("userId"); s != "" {
+		for _, u := range strings.Split(s, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				users = append(users, u)
+			}
+		}
+	} else if users, err = UsageUsers(r.Context(), client); err != nil {
+		WriteKVError(w, err)
+		return
+	}
+	counts, err := UsageCounts(r.Context(), client, users, from, to)
+	if err != nil {
+		WriteKVError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]any{
+		"from":  from.Format(time.DateOnly),
+		"to":    to.Format(time.DateOnly),
+		"users": counts,
+	})
+}
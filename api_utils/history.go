@@ -0,0 +1,148 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot is a previous version of a planner, kept so it can be restored.
+// ID is the save time in Unix nanoseconds and stays stable as newer
+// snapshots are pushed in front of it.
+type Snapshot struct {
+	ID      string          `json:"id"`
+	SavedAt string          `json:"savedAt"`
+	State   json.RawMessage `json:"state"`
+}
+
+// historySuffix ends every HistoryKey; see reservedUserIDs.
+const historySuffix = "history"
+
+// HistoryKey returns the list key holding snapshots of the state at key.
+func HistoryKey(stateKey string) string {
+	return stateKey + ":" + historySuffix
+}
+
+// HistoryLimit returns PLANNER_HISTORY_LIMIT, the number of snapshots kept
+// per planner (default 10). Zero disables snapshots.
+func HistoryLimit() int {
+	s := strings.TrimSpace(os.Getenv("PLANNER_HISTORY_LIMIT"))
+	if s == "" {
+		return 10
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 10
+	}
+	return n
+}
+
+// pushSnapshot records raw as the newest snapshot of the state at key and
+// trims the list to HistoryLimit.
+func pushSnapshot(ctx context.Context, c KV, key, raw string) error {
+	limit := HistoryLimit()
+	if limit == 0 {
+		return nil
+	}
+	now := Now().UTC()
+	b, err := json.Marshal(Snapshot{
+		ID:      strconv.FormatInt(now.UnixNano(), 10),
+		SavedAt: now.Format(time.RFC3339Nano),
+		State:   json.RawMessage(raw),
+	})
+	if err != nil {
+		return err
+	}
+	hk := HistoryKey(key)
+	if _, err := c.LPush(ctx, hk, b); err != nil {
+		return err
+	}
+	if err := c.LTrim(ctx, hk, 0, int64(limit-1)); err != nil {
+		return err
+	}
+	if ttl := StateTTL(); ttl > 0 {
+		return c.Expire(ctx, hk, ttl)
+	}
+	return nil
+}
+
+// snapshotPage is how many snapshots one LRange reads. Each entry holds a
+// whole planner, so lists are read a few entries at a time.
+const snapshotPage = 4
+
+// scanSnapshots calls fn with each raw snapshot of the state at key,
+// newest first, until fn returns false or the list ends.
+func scanSnapshots(ctx context.Context, c KV, key string, fn func(raw string) bool) error {
+	hk := HistoryKey(key)
+	for start := int64(0); ; start += snapshotPage {
+		vals, err := c.LRange(ctx, hk, start, start+snapshotPage-1)
+		if err != nil {
+			return err
+		}
+		for _, v := range vals {
+			if !fn(v) {
+				return nil
+			}
+		}
+		if len(vals) < snapshotPage {
+			return nil
+		}
+	}
+}
+
+// ListSnapshots returns the id and save time of each stored snapshot of
+// the state at key, newest first, without their states. Entries that fail
+// to decode are skipped.
+func ListSnapshots(ctx context.Context, c KV, key string) ([]Snapshot, error) {
+	var snaps []Snapshot
+	seen := map[string]bool{}
+	err := scanSnapshots(ctx, c, key, func(raw string) bool {
+		var s struct {
+			ID      string `json:"id"`
+			SavedAt string `json:"savedAt"`
+		}
+		// A write during the scan shifts the list, so an entry can be read
+		// twice.
+		if json.Unmarshal([]byte(raw), &s) == nil && !seen[s.ID] {
+			seen[s.ID] = true
+			snaps = append(snaps, Snapshot{ID: s.ID, SavedAt: s.SavedAt})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snaps, nil
+}
+
+// FindSnapshot returns the snapshot of the state at key with the given id,
+// reading the list only as far as that snapshot.
+func FindSnapshot(ctx context.Context, c KV, key, id string) (Snapshot, bool, error) {
+	var snap Snapshot
+	var found bool
+	err := scanSnapshots(ctx, c, key, func(raw string) bool {
+		var s Snapshot
+		if json.Unmarshal([]byte(raw), &s) == nil && s.ID == id {
+			snap, found = s, true
+		}
+		return !found
+	})
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	return snap, found, nil
+}
+
+// SnapshotState decodes the planner saved in s, migrated to SchemaVersion
+// and normalized like a loaded state.
+func SnapshotState(s Snapshot) (AppState, error) {
+	st, _, err := Migrate(s.State)
+	if err != nil {
+		return AppState{}, err
+	}
+	NormalizeState(&st)
+	return st, nil
+}
@@ -0,0 +1,130 @@
+package api_utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsPageThroughHistory(t *testing.T) {
+	t.Setenv("PLANNER_HISTORY_LIMIT", "10")
+	t.Setenv("PLANNER_STATE_TTL", "")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	key := StateKey("alice")
+
+	now := testNow
+	defer SetClock(func() time.Time { return now })()
+	var ids []string
+	for i := 0; i < 3*snapshotPage; i++ {
+		now = testNow.Add(time.Duration(i) * time.Second)
+		if err := pushSnapshot(ctx, mem, key, fmt.Sprintf(`{"version":2,"revision":%d}`, i)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append([]string{fmt.Sprint(now.UnixNano())}, ids...)
+	}
+	ids = ids[:10]
+
+	snaps, err := ListSnapshots(ctx, mem, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != len(ids) {
+		t.Fatalf("listed %d snapshots, want %d", len(snaps), len(ids))
+	}
+	for i, s := range snaps {
+		if s.ID != ids[i] || s.State != nil {
+			t.Fatalf("snapshot %d = %s with %d state bytes, want %s without state", i, s.ID, len(s.State), ids[i])
+		}
+	}
+
+	oldest := ids[len(ids)-1]
+	snap, found, err := FindSnapshot(ctx, mem, key, oldest)
+	if err != nil || !found {
+		t.Fatalf("FindSnapshot(oldest) = %v, %v", found, err)
+	}
+	st, err := SnapshotState(snap)
+	if err != nil || st.Revision != 2 {
+		t.Fatalf("oldest kept snapshot = revision %d, %v; want 2", st.Revision, err)
+	}
+	if _, found, _ := FindSnapshot(ctx, mem, key, "missing"); found {
+		t.Fatal("found a snapshot that doesn't exist")
+	}
+}
+
+func TestSnapshotStateMigrates(t *testing.T) {
+	snap := Snapshot{ID: "1", State: []byte(`{"version":1,"tasks":[{"id":"t1","due":"2026-03-02"}]}`)}
+	st, err := SnapshotState(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Version != SchemaVersion {
+		t.Errorf("version = %d, want %d", st.Version, SchemaVersion)
+	}
+	if got := st.Tasks[0]["dueISO"]; got != "2026-03-02" {
+		t.Errorf("dueISO = %v, want the v1 due date", got)
+	}
+	if st.Settings == nil {
+		t.Error("settings were not normalized")
+	}
+	if _, err := SnapshotState(Snapshot{State: []byte(`[1,2]`)}); err == nil {
+		t.Error("a non-object snapshot decoded")
+	}
+}
+
+func TestDerivedKeysDontCollideWithUsers(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	defer SetClock(func() time.Time { return testNow })()
+	exp := float64(testNow.Add(time.Hour).Unix())
+
+	derived := map[string]bool{
+		HistoryKey(StateKey("")):   true,
+		TombstoneKey(StateKey("")): true,
+	}
+	for _, id := range []string{"history", "tombstones", "alice"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/state", nil)
+		r.Header.Set("X-API-Key", "key")
+		r.Header.Set("X-User-ID", id)
+		got, err := ParseAuth(r)
+		if err == nil && derived[StateKey(got)] {
+			t.Errorf("X-User-ID %q maps onto the derived key %s", id, StateKey(got))
+		}
+
+		tok := signJWT(t, "s3cret", map[string]any{"sub": id, "exp": exp})
+		got, err = ParseAuth(bearerRequest(tok))
+		if err == nil && derived[StateKey(got)] {
+			t.Errorf("token sub %q maps onto the derived key %s", id, StateKey(got))
+		}
+		if id == "alice" && (err != nil || got != "alice") {
+			t.Errorf("ParseAuth(alice) = %q, %v", got, err)
+		}
+	}
+}
+
+func TestCompactHistoryOwners(t *testing.T) {
+	t.Setenv("PLANNER_HISTORY_LIMIT", "10")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	// The shared planner and alice both exist; bob's planner is gone.
+	for _, key := range []string{StateKey(""), StateKey("alice"), StateKey("bob")} {
+		if err := pushSnapshot(ctx, mem, key, `{"version":2}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem.SetBody(ctx, StateKey(""), []byte(`{"version":2}`))
+	mem.SetBody(ctx, StateKey("alice"), []byte(`{"version":2}`))
+
+	removed, _, err := compactHistory(ctx, mem)
+	if err != nil || removed != 1 {
+		t.Fatalf("compactHistory removed %d, %v; want only bob's list", removed, err)
+	}
+	for _, key := range []string{StateKey(""), StateKey("alice")} {
+		if snaps, _ := ListSnapshots(ctx, mem, key); len(snaps) != 1 {
+			t.Errorf("%s lost its history", key)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package api_utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// MaxBodyBytes caps request bodies accepted by the handlers.
+const MaxBodyBytes = 2 << 20
+
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ErrBodyTooLarge is returned by ReadBodyLimit when the body exceeds max.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ReadBodyLimit reads at most max bytes of the request body. An oversized
+// body yields ErrBodyTooLarge; any other error means the body could not be
+// read, e.g. because the client went away or stalled.
+func ReadBodyLimit(r *http.Request, max int64) ([]byte, error) {
+	defer r.Body.Close()
+	lr := io.LimitReader(r.Body, max+1)
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(lr); err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	if int64(buf.Len()) > max {
+		return nil, ErrBodyTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteBodyError reports a ReadBodyLimit or CheckJSONShape failure: 400
+// for an oversized, overly complex or truncated body, 408 when reading it
+// timed out, 500 otherwise.
+func WriteBodyError(w http.ResponseWriter, err error) {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		WriteError(w, http.StatusBadRequest, CodeBodyTooLarge, "request too large")
+	case errors.Is(err, ErrBodyTooComplex):
+		WriteError(w, http.StatusBadRequest, CodeBodyTooComplex, err.Error())
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		WriteError(w, http.StatusBadRequest, CodeBodyIncomplete, "request body was cut short")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		WriteError(w, http.StatusRequestTimeout, CodeBodyTimeout, "timed out reading request body")
+	default:
+		WriteError(w, http.StatusInternalServerError, CodeBodyUnreadable, "could not read request body")
+	}
+}
+
+// WriteKVError reports a failed KV call: 504 when the request ran out of
+// time, 500 when what is stored isn't a state document, 503 with Upstash's
+// Retry-After when Upstash throttled us, 502 for anything else the store
+// did wrong.
+func WriteKVError(w http.ResponseWriter, err error) {
+	var terr *ThrottledError
+	if errors.As(err, &terr) {
+		retry := terr.RetryAfter
+		if retry == "" {
+			retry = "1"
+		}
+		w.Header().Set("Retry-After", retry)
+		WriteError(w, http.StatusServiceUnavailable, CodeKVThrottled, "the KV store is throttling requests")
+		return
+	}
+	if errors.Is(err, ErrBadStateBlob) {
+		WriteError(w, http.StatusInternalServerError, CodeStateCorrupt, err.Error())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		WriteError(w, http.StatusGatewayTimeout, CodeKVTimeout, "timed out waiting for the KV store")
+		return
+	}
+	WriteError(w, http.StatusBadGateway, CodeKVUnreachable, err.Error())
+}
+
+// Authorize authenticates the request (see ParseAuth) and resolves the user
+// it acts for, counting the request toward the user's daily usage in h's
+// store. On failure it writes the error response and returns ok=false.
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) (userID string, ok bool) {
+	userID, err := ParseAuth(r)
+	if errors.Is(err, ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="planner"`)
+		WriteError(w, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return "", false
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return "", false
+	}
+	if c, err := h.Store(); err == nil {
+		countUsage(r.Context(), c, userID)
+	}
+	return userID, true
+}
+
+// AuthorizeAdmin lets through only operator credentials (see
+// ParseAdminAuth), for endpoints that see or change every user's data. On
+// failure it writes 401, or 403 for an ordinary user's token, and returns
+// false.
+func AuthorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	err := ParseAdminAuth(r)
+	switch {
+	case errors.Is(err, ErrNotAdmin):
+		WriteError(w, http.StatusForbidden, CodeForbidden, err.Error())
+		return false
+	case err != nil:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="planner"`)
+		WriteError(w, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+		return false
+	}
+	return true
+}
+
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,128}$`)
+
+// reservedUserIDs are the suffixes of keys derived from a state key.
+// StateKey("history") would be HistoryKey(StateKey("")), the shared
+// planner's snapshot list, so these can't be user ids.
+var reservedUserIDs = map[string]bool{historySuffix: true, tombstoneSuffix: true}
+
+// validUserID reports whether id may name a planner.
+func validUserID(id string) bool {
+	return userIDPattern.MatchString(id) && !reservedUserIDs[id]
+}
+
+// requestUserID returns the user the request acts for. X-User-ID is only
+// trusted when the request passed API key auth (i.e. it came through a
+// gateway holding the key); otherwise it is ignored.
+func requestUserID(r *http.Request, authenticated bool) (string, error) {
+	if !authenticated {
+		return "", nil
+	}
+	id := strings.TrimSpace(r.Header.Get("X-User-ID"))
+	if id == "" {
+		return "", nil
+	}
+	if !validUserID(id) {
+		return "", errors.New("invalid X-User-ID")
+	}
+	return id, nil
+}
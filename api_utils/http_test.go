@@ -0,0 +1,82 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cutReader yields data and then fails with err, like a client that goes
+// away mid-upload.
+type cutReader struct {
+	data string
+	err  error
+}
+
+func (c *cutReader) Read(p []byte) (int, error) {
+	if c.data == "" {
+		return 0, c.err
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		want    string
+		wantErr error
+	}{
+		{"under limit", strings.NewReader("12345"), "12345", nil},
+		{"at limit", strings.NewReader("1234567890"), "1234567890", nil},
+		{"oversize", strings.NewReader("12345678901"), "", ErrBodyTooLarge},
+		{"truncated", &cutReader{data: "12345", err: io.ErrUnexpectedEOF}, "", io.ErrUnexpectedEOF},
+		{"timed out", &cutReader{data: "123", err: context.DeadlineExceeded}, "", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/state", tt.body)
+			got, err := ReadBodyLimit(r, 10)
+			if tt.wantErr == nil {
+				if err != nil || string(got) != tt.want {
+					t.Fatalf("ReadBodyLimit = %q, %v; want %q", got, err, tt.want)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != ErrBodyTooLarge && errors.Is(err, ErrBodyTooLarge) {
+				t.Fatalf("read failure %v reported as too large", err)
+			}
+		})
+	}
+}
+
+func TestWriteBodyError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrBodyTooLarge, http.StatusBadRequest, CodeBodyTooLarge},
+		{fmt.Errorf("%w: too deep", ErrBodyTooComplex), http.StatusBadRequest, CodeBodyTooComplex},
+		{fmt.Errorf("reading request body: %w", io.ErrUnexpectedEOF), http.StatusBadRequest, CodeBodyIncomplete},
+		{fmt.Errorf("reading request body: %w", context.DeadlineExceeded), http.StatusRequestTimeout, CodeBodyTimeout},
+		{errors.New("connection reset"), http.StatusInternalServerError, CodeBodyUnreadable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		WriteBodyError(w, tt.err)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+			t.Errorf("WriteBodyError(%v) = %d %s; want %d %s", tt.err, w.Code, w.Body.String(), tt.status, tt.code)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api_utils
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NewID returns a random (version 4) UUID for server-assigned item ids.
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("api_utils: crypto/rand failed: " + err.Error())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// AssignedID records an id the server filled in: the item's position in
+// its collection and the new id.
+type AssignedID struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+}
+
+// AssignMissingIDs gives every course, task and grade without a non-empty
+// string id a NewID, and returns what it assigned keyed by collection.
+// Collections where nothing was assigned are left out.
+func AssignMissingIDs(st *AppState) map[string][]AssignedID {
+	assigned := map[string][]AssignedID{}
+	for name, items := range map[string][]map[string]any{
+		"courses": st.Courses,
+		"tasks":   st.Tasks,
+		"grades":  st.Grades,
+	} {
+		for i, it := range items {
+			if it == nil {
+				continue
+			}
+			if id, _ := it["id"].(string); id != "" {
+				continue
+			}
+			id := NewID()
+			it["id"] = id
+			assigned[name] = append(assigned[name], AssignedID{Index: i, ID: id})
+		}
+	}
+	return assigned
+}
@@ -0,0 +1,72 @@
+package api_utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// idempotencyTTL is how long a completed request can be replayed. It only
+// needs to cover a client's retry window.
+const idempotencyTTL = 10 * time.Minute
+
+// IdempotentResult is a stored response to a request that carried an
+// Idempotency-Key header.
+type IdempotentResult struct {
+	Status int `json:"status"`
+	// RequestHash fingerprints the request body, so a reused key with a
+	// different payload is rejected instead of replayed.
+	RequestHash string          `json:"requestHash"`
+	Body        json.RawMessage `json:"body"`
+	// SavedAt is stamped by SaveIdempotent so Compact can spot records
+	// that outlived idempotencyTTL.
+	SavedAt string `json:"savedAt,omitempty"`
+}
+
+// IdempotencyKey returns the KV key for the Idempotency-Key header of r,
+// namespaced under the planner's stateKey, or "" when the header is absent.
+func IdempotencyKey(r *http.Request, stateKey string) string {
+	h := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if h == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(h))
+	return "idem:" + stateKey + ":" + hex.EncodeToString(sum[:16])
+}
+
+// RequestHash fingerprints a request body for IdempotentResult.
+func RequestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadIdempotent returns the stored result for key, if there is one.
+func LoadIdempotent(ctx context.Context, c KV, key string) (IdempotentResult, bool, error) {
+	val, err := c.GetString(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return IdempotentResult{}, false, nil
+	}
+	if err != nil {
+		return IdempotentResult{}, false, err
+	}
+	var res IdempotentResult
+	if err := json.Unmarshal([]byte(val), &res); err != nil {
+		return IdempotentResult{}, false, nil
+	}
+	return res, true, nil
+}
+
+// SaveIdempotent stores res under key for idempotencyTTL.
+func SaveIdempotent(ctx context.Context, c KV, key string, res IdempotentResult) error {
+	res.SavedAt = Now().UTC().Format(time.RFC3339)
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return c.SetBodyWithTTL(ctx, key, b, idempotencyTTL)
+}
@@ -0,0 +1,195 @@
+package api_utils
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// dueFields lists the task fields that may hold a due date, in order of
+// preference. The web app writes dueISO; older clients sent due.
+var dueFields = []string{"dueISO", "due"}
+
+// TaskDue returns the parsed due time of a task, if it has a usable one.
+func TaskDue(t map[string]any) (time.Time, bool) {
+	for _, f := range dueFields {
+		s, ok := t[f].(string)
+		if !ok || s == "" {
+			continue
+		}
+		if ts, err := time.Parse(time.RFC3339, s); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ItemCourseID returns the courseId of a task or grade, or "".
+func ItemCourseID(it map[string]any) string {
+	s, _ := it["courseId"].(string)
+	return s
+}
+
+// IsDeleted reports whether an item has been soft-deleted, i.e. carries a
+// non-empty deletedAt.
+func IsDeleted(it map[string]any) bool {
+	s, _ := it["deletedAt"].(string)
+	return s != ""
+}
+
+// ErrCourseNotFound is returned by course handlers' MutateState callbacks
+// when the course they were asked about doesn't exist; WriteStateError
+// maps it to 404.
+var ErrCourseNotFound = errors.New("course not found")
+
+// IsArchived reports whether a course has been archived, i.e. carries
+// archived: true. Archived courses keep their tasks and grades.
+func IsArchived(c map[string]any) bool {
+	b, _ := c["archived"].(bool)
+	return b
+}
+
+// WithoutArchived returns st minus its archived courses and their tasks
+// and grades, for views that only cover the current semester. st itself
+// is left unchanged.
+func WithoutArchived(st AppState) AppState {
+	archived := map[string]bool{}
+	for _, c := range st.Courses {
+		if id, _ := c["id"].(string); id != "" && IsArchived(c) {
+			archived[id] = true
+		}
+	}
+	if len(archived) == 0 {
+		return st
+	}
+	keep := func(items []map[string]any, id func(map[string]any) string) []map[string]any {
+		out := make([]map[string]any, 0, len(items))
+		for _, it := range items {
+			if !archived[id(it)] {
+				out = append(out, it)
+			}
+		}
+		return out
+	}
+	ownID := func(c map[string]any) string {
+		s, _ := c["id"].(string)
+		return s
+	}
+	st.Courses = keep(st.Courses, ownID)
+	st.Tasks = keep(st.Tasks, ItemCourseID)
+	st.Grades = keep(st.Grades, ItemCourseID)
+	return st
+}
+
+// PurgeDeleted permanently removes courses, tasks and grades soft-deleted
+// before cutoff, detaching tasks and grades from purged courses. It
+// returns how many items were removed. An unparseable deletedAt counts as
+// old.
+func PurgeDeleted(st *AppState, cutoff time.Time) int {
+	n := 0
+	purge := func(items []map[string]any) []map[string]any {
+		kept := items[:0]
+		for _, it := range items {
+			if s, _ := it["deletedAt"].(string); s != "" {
+				if ts, err := time.Parse(time.RFC3339, s); err != nil || ts.Before(cutoff) {
+					n++
+					continue
+				}
+			}
+			kept = append(kept, it)
+		}
+		return kept
+	}
+
+	before := map[string]bool{}
+	for _, c := range st.Courses {
+		if id, ok := c["id"].(string); ok {
+			before[id] = true
+		}
+	}
+	st.Courses = purge(st.Courses)
+	st.Tasks = purge(st.Tasks)
+	st.Grades = purge(st.Grades)
+	for _, c := range st.Courses {
+		if id, ok := c["id"].(string); ok {
+			delete(before, id)
+		}
+	}
+	for _, items := range [][]map[string]any{st.Tasks, st.Grades} {
+		for _, it := range items {
+			if before[ItemCourseID(it)] {
+				delete(it, "courseId")
+			}
+		}
+	}
+	return n
+}
+
+// doneFields lists the task fields clients have used to mark a task
+// finished. The web app writes done.
+var doneFields = []string{"done", "completed", "isDone"}
+
+// TaskDone reports whether a task is marked finished under any of
+// doneFields.
+func TaskDone(t map[string]any) bool {
+	for _, f := range doneFields {
+		if b, _ := t[f].(bool); b {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskOrder returns a task's position from its order field, set by
+// drag-and-drop reordering, if it has a whole-number one.
+func TaskOrder(t map[string]any) (int, bool) {
+	switch v := t["order"].(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
+// TaskReminderLead returns how long before its due time a task wants to
+// be reminded, from its reminderLeadMinutes field, if it has a usable one
+// (a number of minutes, zero or more).
+func TaskReminderLead(t map[string]any) (time.Duration, bool) {
+	switch v := t["reminderLeadMinutes"].(type) {
+	case int:
+		if v >= 0 {
+			return time.Duration(v) * time.Minute, true
+		}
+	case float64:
+		if v >= 0 && v < math.MaxInt64/float64(time.Minute) {
+			return time.Duration(v * float64(time.Minute)), true
+		}
+	}
+	return 0, false
+}
+
+// SortTasks orders tasks by their order field, then by due date. Tasks
+// without an order come after those with one, and undated tasks after
+// dated ones; ties keep their stored order.
+func SortTasks(tasks []map[string]any) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		oi, iok := TaskOrder(tasks[i])
+		oj, jok := TaskOrder(tasks[j])
+		if iok != jok {
+			return iok
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		di, iok := TaskDue(tasks[i])
+		dj, jok := TaskDue(tasks[j])
+		if iok != jok {
+			return iok
+		}
+		return di.Before(dj)
+	})
+}
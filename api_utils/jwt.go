@@ -0,0 +1,151 @@
+package api_utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is wrapped by ParseAuth when a request's credentials are
+// missing or invalid.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrNotAdmin is wrapped by ParseAdminAuth when a request is
+// authenticated as a user but not as an operator.
+var ErrNotAdmin = errors.New("admin access required")
+
+// jwtLeeway absorbs small clock differences between us and the token issuer.
+const jwtLeeway = 30 * time.Second
+
+// ParseAuth authenticates r and returns the user it acts for. When
+// PLANNER_JWT_SECRET is set, an "Authorization: Bearer <jwt>" header signed
+// with it (HS256) identifies the user by its sub claim. Without a bearer
+// token the static PLANNER_API_KEY rules apply, with X-User-ID picking the
+// user. An empty userID means the shared legacy planner.
+func ParseAuth(r *http.Request) (userID string, err error) {
+	if secret := os.Getenv("PLANNER_JWT_SECRET"); secret != "" {
+		if token, ok := bearerToken(r); ok {
+			claims, err := verifyJWT(token, []byte(secret), Now())
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrUnauthorized, err)
+			}
+			return claims.Sub, nil
+		}
+	}
+
+	apiKey := strings.TrimSpace(os.Getenv("PLANNER_API_KEY"))
+	if apiKey != "" && r.Header.Get("X-API-Key") != apiKey {
+		return "", fmt.Errorf("%w: missing/invalid API key", ErrUnauthorized)
+	}
+	return requestUserID(r, apiKey != "")
+}
+
+// ParseAdminAuth checks that r carries operator credentials: the static
+// PLANNER_API_KEY as X-API-Key, or a bearer token (see ParseAuth) whose
+// admin claim is true. A valid token for an ordinary user fails with
+// ErrNotAdmin; missing or bad credentials with ErrUnauthorized.
+func ParseAdminAuth(r *http.Request) error {
+	apiKey := strings.TrimSpace(os.Getenv("PLANNER_API_KEY"))
+	if apiKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(apiKey)) == 1 {
+		return nil
+	}
+	if secret := os.Getenv("PLANNER_JWT_SECRET"); secret != "" {
+		if token, ok := bearerToken(r); ok {
+			claims, err := verifyJWT(token, []byte(secret), Now())
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+			}
+			if !claims.Admin {
+				return ErrNotAdmin
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: missing/invalid API key", ErrUnauthorized)
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[7:])
+	return token, token != ""
+}
+
+// jwtClaims are the claims verifyJWT reads. Admin marks an operator
+// token, accepted by ParseAdminAuth.
+type jwtClaims struct {
+	Sub   string   `json:"sub"`
+	Admin bool     `json:"admin"`
+	Exp   *float64 `json:"exp"`
+	Nbf   *float64 `json:"nbf"`
+}
+
+// verifyJWT checks an HS256 token's signature and expiry and returns its
+// claims. Tokens must carry exp; a planner session that never expires is
+// more likely a mistake than a choice.
+func verifyJWT(token string, secret []byte, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return jwtClaims{}, err
+	}
+	if header.Alg != "HS256" {
+		return jwtClaims{}, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, errors.New("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return jwtClaims{}, errors.New("invalid token signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return jwtClaims{}, err
+	}
+	if claims.Exp == nil {
+		return jwtClaims{}, errors.New("token has no exp")
+	}
+	if now.After(time.Unix(int64(*claims.Exp), 0).Add(jwtLeeway)) {
+		return jwtClaims{}, errors.New("token expired")
+	}
+	if claims.Nbf != nil && now.Add(jwtLeeway).Before(time.Unix(int64(*claims.Nbf), 0)) {
+		return jwtClaims{}, errors.New("token not yet valid")
+	}
+	if !validUserID(claims.Sub) {
+		return jwtClaims{}, errors.New("token sub is not a valid user id")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
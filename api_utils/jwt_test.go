@@ -0,0 +1,140 @@
+package api_utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// signJWT builds an HS256 token for claims under secret.
+func signJWT(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	head := enc(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + enc(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(head))
+	return head + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/state", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestParseAuthJWT(t *testing.T) {
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	t.Setenv("PLANNER_API_KEY", "")
+	defer SetClock(func() time.Time { return testNow })()
+	exp := float64(testNow.Add(time.Hour).Unix())
+
+	tests := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr bool
+	}{
+		{"valid", signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": exp}), "alice", false},
+		{"expired", signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": float64(testNow.Add(-time.Hour).Unix())}), "", true},
+		{"within leeway", signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": float64(testNow.Add(-10 * time.Second).Unix())}), "alice", false},
+		{"wrong signature", signJWT(t, "other", map[string]any{"sub": "alice", "exp": exp}), "", true},
+		{"no exp", signJWT(t, "s3cret", map[string]any{"sub": "alice"}), "", true},
+		{"bad sub", signJWT(t, "s3cret", map[string]any{"sub": "../etc", "exp": exp}), "", true},
+		{"malformed", "not.a.jwt", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := ParseAuth(bearerRequest(tt.token))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Fatalf("err = %v, want ErrUnauthorized", err)
+				}
+				return
+			}
+			if err != nil || sub != tt.wantSub {
+				t.Fatalf("ParseAuth = %q, %v; want %q", sub, err, tt.wantSub)
+			}
+		})
+	}
+}
+
+func TestParseAuthTamperedPayload(t *testing.T) {
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	defer SetClock(func() time.Time { return testNow })()
+	token := signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": float64(testNow.Add(time.Hour).Unix())})
+	forged := signJWT(t, "s3cret", map[string]any{"sub": "mallory", "exp": float64(testNow.Add(time.Hour).Unix())})
+
+	// Swap in another token's payload while keeping the original signature.
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	if _, err := ParseAuth(bearerRequest(tampered)); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestParseAdminAuth(t *testing.T) {
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	t.Setenv("PLANNER_API_KEY", "key")
+	defer SetClock(func() time.Time { return testNow })()
+	exp := float64(testNow.Add(time.Hour).Unix())
+
+	withKey := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+	withKey.Header.Set("X-API-Key", "key")
+	wrongKey := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+	wrongKey.Header.Set("X-API-Key", "nope")
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want error
+	}{
+		{"api key", withKey, nil},
+		{"wrong api key", wrongKey, ErrUnauthorized},
+		{"no credentials", httptest.NewRequest(http.MethodGet, "/api/usage", nil), ErrUnauthorized},
+		{"admin token", bearerRequest(signJWT(t, "s3cret", map[string]any{"sub": "ops", "admin": true, "exp": exp})), nil},
+		{"user token", bearerRequest(signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": exp})), ErrNotAdmin},
+		{"forged admin token", bearerRequest(signJWT(t, "other", map[string]any{"sub": "ops", "admin": true, "exp": exp})), ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseAdminAuth(tt.r)
+			if tt.want == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeAdminStatus(t *testing.T) {
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	t.Setenv("PLANNER_API_KEY", "key")
+	defer SetClock(func() time.Time { return testNow })()
+	user := signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": float64(testNow.Add(time.Hour).Unix())})
+
+	w := httptest.NewRecorder()
+	if AuthorizeAdmin(w, bearerRequest(user)) || w.Code != http.StatusForbidden {
+		t.Fatalf("user token: code %d, want 403", w.Code)
+	}
+	w = httptest.NewRecorder()
+	if AuthorizeAdmin(w, httptest.NewRequest(http.MethodGet, "/", nil)) || w.Code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: code %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package api_utils
+
+import (
+	"context"
+	"time"
+)
+
+// KV is the key-value store the planner keeps its data in. UpstashClient
+// is the production implementation; MemoryKV stands in for it in tests
+// and local experiments.
+type KV interface {
+	// Backend names the implementation, for diagnostics.
+	Backend() string
+	Ping(ctx context.Context) error
+
+	// GetString returns ErrKeyNotFound when key does not exist.
+	GetString(ctx context.Context, key string) (string, error)
+	MGet(ctx context.Context, keys ...string) ([]string, []bool, error)
+	SetBody(ctx context.Context, key string, value []byte) error
+	SetBodyWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	Increment(ctx context.Context, key string, by int64) (int64, error)
+	Delete(ctx context.Context, key string) error
+	ListKeys(ctx context.Context, prefix string) ([]string, error)
+	Pipeline(ctx context.Context, ops []KVOp) error
+
+	LPush(ctx context.Context, key string, value []byte) (int64, error)
+	LTrim(ctx context.Context, key string, start, stop int64) error
+	LRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+
+	Publish(ctx context.Context, channel string, msg []byte) (int64, error)
+	// Subscribe returns errors.ErrUnsupported when the backend can't push
+	// messages; callers are expected to fall back to polling.
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+var _ KV = (*UpstashClient)(nil)
+
+// KVInfo is what a store reports about itself for /api/health.
+type KVInfo struct {
+	// Keys is the number of keys in the database, or -1 if unknown.
+	Keys int64
+}
+
+// InfoPinger is implemented by stores that can gather KVInfo in the same
+// round trip as a ping. An error means the store is unreachable; info the
+// store could not gather is reported as unknown instead.
+type InfoPinger interface {
+	PingInfo(ctx context.Context) (KVInfo, error)
+}
+
+var (
+	_ InfoPinger = (*UpstashClient)(nil)
+	_ InfoPinger = (*MemoryKV)(nil)
+)
+
+// ZSetKV is implemented by stores that support sorted sets. Callers
+// type-assert for it and fall back to something simpler when a store
+// doesn't. Scores may be math.Inf(-1) or math.Inf(1) for open ranges.
+type ZSetKV interface {
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	// ZRangeByScore returns members with min <= score <= max, lowest
+	// score first.
+	ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error)
+	// ZRemRangeByScore removes members with min <= score <= max.
+	ZRemRangeByScore(ctx context.Context, key string, min, max float64) error
+	ZCard(ctx context.Context, key string) (int64, error)
+}
+
+var (
+	_ ZSetKV = (*UpstashClient)(nil)
+	_ ZSetKV = (*MemoryKV)(nil)
+)
+
+// KVProvider builds the store DefaultHandler serves from. It defaults to
+// the Upstash client configured from the environment; tests instead build
+// a Handler around a MemoryKV with NewHandler.
+var KVProvider = func() (KV, error) {
+	c, err := NewUpstashFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewKVFromEnv returns the store from KVProvider.
+func NewKVFromEnv() (KV, error) {
+	return KVProvider()
+}
+
+// mgetBatch is how many keys one MGet call reads. Upstash takes MGET keys
+// in the URL, so long key lists go in batches.
+const mgetBatch = 100
+
+// mgetBatched is MGet for any number of keys, mgetBatch at a time.
+func mgetBatched(ctx context.Context, c KV, keys []string) ([]string, []bool, error) {
+	vals := make([]string, 0, len(keys))
+	found := make([]bool, 0, len(keys))
+	for start := 0; start < len(keys); start += mgetBatch {
+		end := min(start+mgetBatch, len(keys))
+		v, f, err := c.MGet(ctx, keys[start:end]...)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals, found = append(vals, v...), append(found, f...)
+	}
+	return vals, found, nil
+}
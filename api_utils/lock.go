@@ -0,0 +1,57 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStateLocked is returned when another request holds the write lock on
+// a planner for longer than lockWait.
+var ErrStateLocked = errors.New("state is being updated by another request")
+
+const (
+	// lockTTL bounds how long a crashed writer can block others.
+	lockTTL  = 10 * time.Second
+	lockWait = time.Second
+	lockPoll = 50 * time.Millisecond
+)
+
+// LockKey returns the key guarding writes to the state at key.
+func LockKey(stateKey string) string {
+	return "lock:" + stateKey
+}
+
+// lockState takes the write lock for the state at key, polling for up to
+// lockWait. The returned release func is safe to call once the write is
+// done; it only deletes the lock if this request still owns it.
+func lockState(ctx context.Context, c KV, key string) (func(), error) {
+	lk := LockKey(key)
+	token := NewID()
+	deadline := time.Now().Add(lockWait)
+	for {
+		ok, err := c.SetNX(ctx, lk, []byte(token), lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrStateLocked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+	return func() {
+		// GET-then-DEL is not atomic, but the window only matters if the
+		// lock expired mid-write, which lockTTL makes unlikely.
+		cur, err := c.GetString(context.WithoutCancel(ctx), lk)
+		if err == nil && cur == token {
+			_ = c.Delete(context.WithoutCancel(ctx), lk)
+		}
+	}, nil
+}
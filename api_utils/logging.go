@@ -0,0 +1,101 @@
+package api_utils
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Logger writes one JSON object per line, which Vercel's log viewer
+// indexes field by field.
+var Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+type requestIDKey struct{}
+
+// requestIDPattern bounds what a client may send as X-Request-ID, since it
+// ends up in logs and response headers.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// WithRequestID gives each request an id, taken from a well-formed
+// X-Request-ID header or freshly generated, stores it in the request
+// context and echoes it in the X-Request-ID response header.
+func WithRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = NewID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
+
+// RequestID returns the id WithRequestID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// LoggerFrom returns Logger with the request id from ctx attached, so
+// every line logged while serving one request can be correlated.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return Logger.With("request_id", id)
+	}
+	return Logger
+}
+
+// statusRecorder captures what a handler wrote so middleware can report it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// WithLogging logs one structured line per request once next returns and
+// counts the request in Metrics.
+func WithLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		Metrics.ObserveRequest(r.URL.Path, rec.status)
+		LoggerFrom(r.Context()).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes", rec.size,
+		)
+	}
+}
@@ -0,0 +1,478 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryKV is an in-process KV. It keeps everything in maps guarded by a
+// mutex, honors TTLs, and delivers Publish to Subscribe on the same
+// instance, which makes it a drop-in store for handler tests.
+type MemoryKV struct {
+	mu      sync.Mutex
+	entries map[string]*memEntry
+	subs    map[string][]chan []byte
+	now     func() time.Time
+}
+
+type memEntry struct {
+	value   []byte
+	list    [][]byte // set for list keys instead of value
+	isList  bool
+	zset    map[string]float64 // set for sorted-set keys instead of value
+	expires time.Time          // zero means no expiry
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{
+		entries: map[string]*memEntry{},
+		subs:    map[string][]chan []byte{},
+		now:     time.Now,
+	}
+}
+
+var _ KV = (*MemoryKV)(nil)
+
+func (m *MemoryKV) Backend() string { return "memory" }
+
+func (m *MemoryKV) Ping(ctx context.Context) error { return ctx.Err() }
+
+func (m *MemoryKV) PingInfo(ctx context.Context) (KVInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return KVInfo{Keys: -1}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for k := range m.entries {
+		if m.get(k) != nil {
+			n++
+		}
+	}
+	return KVInfo{Keys: n}, nil
+}
+
+// clone returns a deep copy of e, or nil for a nil e.
+func (e *memEntry) clone() *memEntry {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.value = append([]byte(nil), e.value...)
+	if e.list != nil {
+		c.list = append([][]byte(nil), e.list...)
+	}
+	if e.zset != nil {
+		c.zset = make(map[string]float64, len(e.zset))
+		for k, v := range e.zset {
+			c.zset[k] = v
+		}
+	}
+	return &c
+}
+
+// get returns the live entry for key, dropping it if it has expired.
+// m.mu must be held.
+func (m *MemoryKV) get(key string) *memEntry {
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (m *MemoryKV) GetString(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.get(key)
+	if e == nil {
+		return "", ErrKeyNotFound
+	}
+	if e.isList || e.zset != nil {
+		return "", errWrongType
+	}
+	return string(e.value), nil
+}
+
+func (m *MemoryKV) MGet(ctx context.Context, keys ...string) ([]string, []bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vals := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, k := range keys {
+		if e := m.get(k); e != nil && !e.isList && e.zset == nil {
+			vals[i], found[i] = string(e.value), true
+		}
+	}
+	return vals, found, nil
+}
+
+func (m *MemoryKV) SetBody(ctx context.Context, key string, value []byte) error {
+	return m.SetBodyWithTTL(ctx, key, value, 0)
+}
+
+func (m *MemoryKV) SetBodyWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, ttl)
+	return nil
+}
+
+// set stores a string value. m.mu must be held.
+func (m *MemoryKV) set(key string, value []byte, ttl time.Duration) {
+	e := &memEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expires = m.now().Add(ttl)
+	}
+	m.entries[key] = e
+}
+
+func (m *MemoryKV) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.get(key) != nil {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *MemoryKV) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e := m.get(key); e != nil {
+		e.expires = m.now().Add(ttl)
+	}
+	return nil
+}
+
+func (m *MemoryKV) Increment(ctx context.Context, key string, by int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.incr(key, by)
+}
+
+// incr adds by to the counter at key, keeping its expiry. m.mu must be held.
+func (m *MemoryKV) incr(key string, by int64) (int64, error) {
+	e := m.get(key)
+	var n int64
+	if e != nil {
+		if e.isList || e.zset != nil {
+			return 0, errWrongType
+		}
+		var err error
+		if n, err = strconv.ParseInt(string(e.value), 10, 64); err != nil {
+			return 0, errors.New("memory kv: value is not an integer")
+		}
+	} else {
+		e = &memEntry{}
+		m.entries[key] = e
+	}
+	n += by
+	e.value = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (m *MemoryKV) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryKV) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.entries {
+		if strings.HasPrefix(k, prefix) && m.get(k) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Pipeline applies ops under a single lock, so no other caller observes a
+// partial result. If an op fails, the ones before it are rolled back and
+// the store is left as it was. That is stricter than Redis, which keeps
+// the other commands of a transaction, so a test never passes on a
+// half-applied write.
+func (m *MemoryKV) Pipeline(ctx context.Context, ops []KVOp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := map[string]*memEntry{}
+	for _, op := range ops {
+		if _, ok := saved[op.Key]; !ok {
+			saved[op.Key] = m.get(op.Key).clone()
+		}
+	}
+	if err := m.pipeline(ops); err != nil {
+		for k, e := range saved {
+			if e == nil {
+				delete(m.entries, k)
+			} else {
+				m.entries[k] = e
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// pipeline applies ops in order, stopping at the first that fails.
+// m.mu must be held.
+func (m *MemoryKV) pipeline(ops []KVOp) error {
+	for i, op := range ops {
+		switch op.Kind {
+		case KVSet:
+			m.set(op.Key, op.Value, op.TTL)
+		case KVDel:
+			delete(m.entries, op.Key)
+		case KVIncr:
+			if _, err := m.incr(op.Key, op.By); err != nil {
+				return fmt.Errorf("pipeline op %d: %w", i, err)
+			}
+		case KVExpire:
+			if e := m.get(op.Key); e != nil {
+				e.expires = m.now().Add(op.TTL)
+			}
+		case KVZAdd:
+			if err := m.zadd(op.Key, op.Score, op.Member); err != nil {
+				return fmt.Errorf("pipeline op %d: %w", i, err)
+			}
+		case KVZRemRangeByScore:
+			if err := m.zremRangeByScore(op.Key, op.Min, op.Max); err != nil {
+				return fmt.Errorf("pipeline op %d: %w", i, err)
+			}
+		case KVLPush:
+			if _, err := m.lpush(op.Key, op.Value); err != nil {
+				return fmt.Errorf("pipeline op %d: %w", i, err)
+			}
+		case KVLTrim:
+			if err := m.ltrim(op.Key, op.Start, op.Stop); err != nil {
+				return fmt.Errorf("pipeline op %d: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("pipeline: unknown op %q", op.Kind)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryKV) LPush(ctx context.Context, key string, value []byte) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lpush(key, value)
+}
+
+func (m *MemoryKV) lpush(key string, value []byte) (int64, error) {
+	e := m.get(key)
+	if e == nil {
+		e = &memEntry{isList: true}
+		m.entries[key] = e
+	}
+	if !e.isList {
+		return 0, errWrongType
+	}
+	e.list = append([][]byte{append([]byte(nil), value...)}, e.list...)
+	return int64(len(e.list)), nil
+}
+
+func (m *MemoryKV) LTrim(ctx context.Context, key string, start, stop int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ltrim(key, start, stop)
+}
+
+func (m *MemoryKV) ltrim(key string, start, stop int64) error {
+	e := m.get(key)
+	if e == nil {
+		return nil
+	}
+	if !e.isList {
+		return errWrongType
+	}
+	lo, hi := listRange(len(e.list), start, stop)
+	if lo > hi {
+		delete(m.entries, key)
+		return nil
+	}
+	e.list = e.list[lo : hi+1]
+	return nil
+}
+
+func (m *MemoryKV) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.get(key)
+	if e == nil {
+		return []string{}, nil
+	}
+	if !e.isList {
+		return nil, errWrongType
+	}
+	lo, hi := listRange(len(e.list), start, stop)
+	out := []string{}
+	for i := lo; i <= hi; i++ {
+		out = append(out, string(e.list[i]))
+	}
+	return out, nil
+}
+
+// listRange resolves Redis-style start/stop indexes (negative counts from
+// the end, both inclusive) against a list of length n. lo > hi means empty.
+func listRange(n int, start, stop int64) (lo, hi int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	return int(start), int(stop)
+}
+
+func (m *MemoryKV) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zadd(key, score, member)
+}
+
+// zadd sets member's score in the sorted set at key. m.mu must be held.
+func (m *MemoryKV) zadd(key string, score float64, member string) error {
+	e := m.get(key)
+	if e == nil {
+		e = &memEntry{zset: map[string]float64{}}
+		m.entries[key] = e
+	}
+	if e.zset == nil {
+		return errWrongType
+	}
+	e.zset[member] = score
+	return nil
+}
+
+// ZRangeByScore orders members by score, then lexically, as Redis does.
+func (m *MemoryKV) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.get(key)
+	if e == nil {
+		return []string{}, nil
+	}
+	if e.zset == nil {
+		return nil, errWrongType
+	}
+	members := []string{}
+	for member, score := range e.zset {
+		if score >= min && score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		si, sj := e.zset[members[i]], e.zset[members[j]]
+		if si != sj {
+			return si < sj
+		}
+		return members[i] < members[j]
+	})
+	return members, nil
+}
+
+func (m *MemoryKV) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zremRangeByScore(key, min, max)
+}
+
+// zremRangeByScore drops members scored min through max, and the key once
+// it is empty, as Redis does. m.mu must be held.
+func (m *MemoryKV) zremRangeByScore(key string, min, max float64) error {
+	e := m.get(key)
+	if e == nil {
+		return nil
+	}
+	if e.zset == nil {
+		return errWrongType
+	}
+	for member, score := range e.zset {
+		if score >= min && score <= max {
+			delete(e.zset, member)
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *MemoryKV) ZCard(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.get(key)
+	if e == nil {
+		return 0, nil
+	}
+	if e.zset == nil {
+		return 0, errWrongType
+	}
+	return int64(len(e.zset)), nil
+}
+
+// Publish delivers msg to every current subscriber of channel. A
+// subscriber that isn't keeping up misses the message rather than
+// blocking the publisher.
+func (m *MemoryKV) Publish(ctx context.Context, channel string, msg []byte) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, ch := range m.subs[channel] {
+		select {
+		case ch <- append([]byte(nil), msg...):
+			n++
+		default:
+		}
+	}
+	return n, nil
+}
+
+// Subscribe returns a channel of messages published to channel until ctx
+// is done, at which point it is closed.
+func (m *MemoryKV) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	ch := make(chan []byte, 16)
+	m.mu.Lock()
+	m.subs[channel] = append(m.subs[channel], ch)
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		subs := m.subs[channel]
+		for i, c := range subs {
+			if c == ch {
+				m.subs[channel] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+var errWrongType = errors.New("memory kv: operation against a key holding the wrong kind of value")
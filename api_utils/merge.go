@@ -0,0 +1,54 @@
+package api_utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MergePatch applies an RFC 7396 JSON merge patch to target and returns
+// the result: objects merge recursively, null removes a key, and any other
+// value replaces what was there. target may be modified in place.
+func MergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = MergePatch(t[k], v)
+	}
+	return t
+}
+
+// UpsertByID merge-patches each element of patch into the item of items
+// with the same "id", appending elements whose id is new. Every element
+// must be an object with a string id.
+func UpsertByID(items []map[string]any, patch any) ([]map[string]any, error) {
+	arr, ok := patch.([]any)
+	if !ok {
+		return nil, errors.New("must be an array")
+	}
+	for i, el := range arr {
+		obj, ok := el.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("element %d must be an object", i)
+		}
+		id, ok := obj["id"].(string)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("element %d must have a string id", i)
+		}
+		if j := IndexByID(items, id); j >= 0 {
+			items[j] = MergePatch(items[j], obj).(map[string]any)
+		} else {
+			items = append(items, MergePatch(nil, obj).(map[string]any))
+		}
+	}
+	return items, nil
+}
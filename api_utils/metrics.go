@@ -0,0 +1,125 @@
+package api_utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is a small in-process registry rendered in the Prometheus text
+// format. On serverless each warm instance keeps its own counts.
+var Metrics = newRegistry()
+
+// kvBuckets are the upper bounds, in seconds, of the KV latency histogram.
+var kvBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type registry struct {
+	mu       sync.Mutex
+	requests map[[2]string]uint64 // {path, status}
+	kvTime   map[string]*histogram
+	kvErrors map[string]uint64
+}
+
+func newRegistry() *registry {
+	return &registry{
+		requests: map[[2]string]uint64{},
+		kvTime:   map[string]*histogram{},
+		kvErrors: map[string]uint64{},
+	}
+}
+
+// ObserveRequest counts one finished HTTP request.
+func (m *registry) ObserveRequest(path string, status int) {
+	m.mu.Lock()
+	m.requests[[2]string{path, fmt.Sprint(status)}]++
+	m.mu.Unlock()
+}
+
+// ObserveKV records the latency and outcome of one KV operation.
+func (m *registry) ObserveKV(op string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.kvTime[op]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(kvBuckets))}
+		m.kvTime[op] = h
+	}
+	secs := d.Seconds()
+	for i, le := range kvBuckets {
+		if secs <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+	if err != nil {
+		m.kvErrors[op]++
+	}
+}
+
+// WriteText renders the registry in the Prometheus text exposition format.
+func (m *registry) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP planner_http_requests_total HTTP requests by path and status.")
+	fmt.Fprintln(w, "# TYPE planner_http_requests_total counter")
+	reqKeys := make([][2]string, 0, len(m.requests))
+	for k := range m.requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		if reqKeys[i][0] != reqKeys[j][0] {
+			return reqKeys[i][0] < reqKeys[j][0]
+		}
+		return reqKeys[i][1] < reqKeys[j][1]
+	})
+	for _, k := range reqKeys {
+		fmt.Fprintf(w, "planner_http_requests_total{path=%s,status=%s} %d\n", quoteLabel(k[0]), quoteLabel(k[1]), m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP planner_kv_op_duration_seconds KV operation latency.")
+	fmt.Fprintln(w, "# TYPE planner_kv_op_duration_seconds histogram")
+	for _, op := range sortedKeys(m.kvTime) {
+		h := m.kvTime[op]
+		var cum uint64
+		for i, le := range kvBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "planner_kv_op_duration_seconds_bucket{op=%s,le=\"%g\"} %d\n", quoteLabel(op), le, cum)
+		}
+		fmt.Fprintf(w, "planner_kv_op_duration_seconds_bucket{op=%s,le=\"+Inf\"} %d\n", quoteLabel(op), h.count)
+		fmt.Fprintf(w, "planner_kv_op_duration_seconds_sum{op=%s} %g\n", quoteLabel(op), h.sum)
+		fmt.Fprintf(w, "planner_kv_op_duration_seconds_count{op=%s} %d\n", quoteLabel(op), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP planner_kv_errors_total Failed KV operations.")
+	fmt.Fprintln(w, "# TYPE planner_kv_errors_total counter")
+	for _, op := range sortedKeys(m.kvErrors) {
+		fmt.Fprintf(w, "planner_kv_errors_total{op=%s} %d\n", quoteLabel(op), m.kvErrors[op])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
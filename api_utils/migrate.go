@@ -0,0 +1,168 @@
+package api_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Migration upgrades a decoded state document by one schema version.
+type Migration func(doc map[string]any) map[string]any
+
+// migrations[v] upgrades a version v document to v+1. Register a new entry
+// here whenever SchemaVersion is bumped.
+var migrations = map[int]Migration{
+	1: migrateV1ToV2,
+}
+
+// downgrades[v] turns a version v document back into version v-1, for
+// clients that still speak an older schema. Each entry mirrors
+// migrations[v-1].
+var downgrades = map[int]Migration{
+	2: migrateV2ToV1,
+}
+
+// ErrBadStateBlob is wrapped by Migrate when a stored value is not a
+// state document: state is always stored as the JSON text of an AppState
+// object.
+var ErrBadStateBlob = errors.New("stored state is not a valid state document")
+
+// ErrSchemaVersion is returned for a schema version this server can't serve.
+var ErrSchemaVersion = errors.New("unsupported schema version")
+
+// ParseSchemaVersion reads the X-Schema-Version request header. A missing
+// header means SchemaVersion; anything outside 1..SchemaVersion is an error.
+func ParseSchemaVersion(r *http.Request) (int, error) {
+	h := strings.TrimSpace(r.Header.Get("X-Schema-Version"))
+	if h == "" {
+		return SchemaVersion, nil
+	}
+	v, err := strconv.Atoi(h)
+	if err != nil || v < 1 || v > SchemaVersion {
+		return 0, fmt.Errorf("%w %q; this server supports 1 to %d", ErrSchemaVersion, h, SchemaVersion)
+	}
+	return v, nil
+}
+
+// MigrateFrom is Migrate for a document the client says is in schema
+// version from, whatever its own version field claims.
+func MigrateFrom(raw []byte, from int) (AppState, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil || doc == nil {
+		return AppState{}, fmt.Errorf("state is not a JSON object")
+	}
+	doc["version"] = from
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return AppState{}, err
+	}
+	st, _, err := Migrate(b)
+	return st, err
+}
+
+// Downgrade converts a current-schema state blob to schema version to by
+// running the registered downgrades in reverse order.
+func Downgrade(raw []byte, to int) ([]byte, error) {
+	if to >= SchemaVersion {
+		return raw, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("state is not a JSON object")
+	}
+	for v := SchemaVersion; v > to; v-- {
+		d, ok := downgrades[v]
+		if !ok {
+			return nil, fmt.Errorf("no downgrade from schema version %d", v)
+		}
+		doc = d(doc)
+		doc["version"] = v - 1
+	}
+	return json.Marshal(doc)
+}
+
+// Migrate decodes a stored state blob and runs the registered migrations
+// needed to bring it up to SchemaVersion. A document without a version is
+// treated as version 1. It reports whether any migration ran so callers
+// can write the upgraded state back.
+func Migrate(raw []byte) (AppState, bool, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil && !json.Valid(raw) {
+		return AppState{}, false, fmt.Errorf("%w: not valid JSON: %v", ErrBadStateBlob, err)
+	}
+	if doc == nil {
+		return AppState{}, false, fmt.Errorf("%w: not a JSON object", ErrBadStateBlob)
+	}
+
+	v := 1
+	if f, ok := doc["version"].(float64); ok && f >= 1 {
+		v = int(f)
+	}
+	migrated := false
+	for ; v < SchemaVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return AppState{}, false, fmt.Errorf("no migration from schema version %d", v)
+		}
+		doc = m(doc)
+		doc["version"] = v + 1
+		migrated = true
+	}
+
+	var st AppState
+	if !migrated {
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return AppState{}, false, fmt.Errorf("%w: %v", ErrBadStateBlob, err)
+		}
+		return st, false, nil
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return AppState{}, false, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return AppState{}, false, fmt.Errorf("%w: migrated state does not decode: %v", ErrBadStateBlob, err)
+	}
+	return st, true, nil
+}
+
+// docItems returns the objects in the array doc[field], skipping anything
+// that isn't an object.
+func docItems(doc map[string]any, field string) []map[string]any {
+	arr, _ := doc[field].([]any)
+	items := make([]map[string]any, 0, len(arr))
+	for _, it := range arr {
+		if m, ok := it.(map[string]any); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+// migrateV1ToV2 renames the task field due to dueISO, the name the web app
+// has used since version 2.
+func migrateV1ToV2(doc map[string]any) map[string]any {
+	for _, t := range docItems(doc, "tasks") {
+		if due, ok := t["due"]; ok {
+			if _, has := t["dueISO"]; !has {
+				t["dueISO"] = due
+			}
+			delete(t, "due")
+		}
+	}
+	return doc
+}
+
+// migrateV2ToV1 undoes migrateV1ToV2, renaming dueISO back to due.
+func migrateV2ToV1(doc map[string]any) map[string]any {
+	for _, t := range docItems(doc, "tasks") {
+		if due, ok := t["dueISO"]; ok {
+			t["due"] = due
+			delete(t, "dueISO")
+		}
+	}
+	return doc
+}
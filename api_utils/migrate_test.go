@@ -0,0 +1,15 @@
+package api_utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMigrateRejectsNonObjectStrings(t *testing.T) {
+	// A string value that holds JSON other than an object isn't a state.
+	for _, raw := range []string{`42`, `[1,2]`, `"text"`, `null`, `not json`} {
+		if _, _, err := Migrate([]byte(raw)); !errors.Is(err, ErrBadStateBlob) {
+			t.Errorf("Migrate(%s) err = %v, want ErrBadStateBlob", raw, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package api_utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitPerMinute returns PLANNER_RATE_LIMIT, the number of requests a
+// caller may make per minute. Zero (the default) disables limiting.
+func RateLimitPerMinute() int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("PLANNER_RATE_LIMIT")))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// WithRateLimit allows each caller perMinute requests in any 60-second
+// window. Callers are identified by their authenticated user, or by client
+// IP when the request carries no valid credentials. Counters live in
+// client so the limit holds across serverless instances. If client is nil
+// (the store isn't configured) or unreachable the request is let through.
+func WithRateLimit(next http.HandlerFunc, client KV, perMinute int) http.HandlerFunc {
+	if perMinute <= 0 || client == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		var allowed bool
+		var retryAfter int64
+		var err error
+		if zs, ok := client.(ZSetKV); ok {
+			allowed, retryAfter, err = slidingWindow(r.Context(), client, zs, callerID(r), perMinute, Now())
+		} else {
+			allowed, retryAfter, err = fixedWindow(r.Context(), client, callerID(r), perMinute, Now())
+		}
+		if err != nil {
+			LoggerFrom(r.Context()).Warn("rate limit check failed", "error", err.Error())
+			next(w, r)
+			return
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			WriteError(w, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// slidingWindow keeps a log of the caller's requests from the last minute
+// in a sorted set scored by time, so a burst straddling a minute boundary
+// still counts against one limit. Rejected requests are logged too: a
+// caller that keeps retrying stays limited, and one that waits a full
+// minute is guaranteed a clean slate.
+func slidingWindow(ctx context.Context, client KV, zs ZSetKV, caller string, perMinute int, now time.Time) (bool, int64, error) {
+	key := "ratelimit:" + caller
+	ms := float64(now.UnixMilli())
+	err := client.Pipeline(ctx, []KVOp{
+		{Kind: KVZRemRangeByScore, Key: key, Min: math.Inf(-1), Max: ms - 60_000},
+		{Kind: KVZAdd, Key: key, Score: ms, Member: NewID()},
+		{Kind: KVExpire, Key: key, TTL: time.Minute},
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := zs.ZCard(ctx, key)
+	if err != nil {
+		return false, 0, err
+	}
+	return n <= int64(perMinute), 60, nil
+}
+
+// fixedWindow counts requests per calendar minute, for stores without
+// sorted sets. It lets up to twice the limit through across a minute
+// boundary.
+func fixedWindow(ctx context.Context, client KV, caller string, perMinute int, now time.Time) (bool, int64, error) {
+	window := now.Unix() / 60
+	key := "ratelimit:" + caller + ":" + strconv.FormatInt(window, 10)
+	n, err := client.Increment(ctx, key, 1)
+	if err != nil {
+		return false, 0, err
+	}
+	if n == 1 {
+		if err := client.Expire(ctx, key, 2*time.Minute); err != nil {
+			LoggerFrom(ctx).Warn("rate limit expire failed", "error", err.Error())
+		}
+	}
+	return n <= int64(perMinute), 60 - now.Unix()%60, nil
+}
+
+// callerID returns a short, non-reversible id for the caller so user ids
+// never appear in KV key names. Unchecked headers never pick the bucket:
+// a request whose credentials don't verify, or one to a server with no
+// credentials configured, is limited by client IP, so sending a fresh
+// key with each request doesn't reset the count.
+func callerID(r *http.Request) string {
+	id := "ip:" + clientIP(r)
+	if userID, ok := authenticatedUser(r); ok {
+		id = "user:" + userID
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// authenticatedUser returns the user ParseAuth resolves r to, if r proved
+// it with a verified token or the configured API key.
+func authenticatedUser(r *http.Request) (string, bool) {
+	_, bearer := bearerToken(r)
+	jwt := bearer && os.Getenv("PLANNER_JWT_SECRET") != ""
+	if !jwt && strings.TrimSpace(os.Getenv("PLANNER_API_KEY")) == "" {
+		return "", false
+	}
+	userID, err := ParseAuth(r)
+	if err != nil {
+		return "", false
+	}
+	return userID, true
+}
+
+// clientIP prefers the first X-Forwarded-For hop, which Vercel sets to the
+// real client address.
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,129 @@
+package api_utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateLimitRequest(ip string, hdr ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/state", nil)
+	r.RemoteAddr = ip + ":1234"
+	for i := 0; i+1 < len(hdr); i += 2 {
+		r.Header.Set(hdr[i], hdr[i+1])
+	}
+	return r
+}
+
+func TestCallerIDUsesAuthenticatedUser(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "s3cret")
+	defer SetClock(func() time.Time { return testNow })()
+	exp := float64(testNow.Add(time.Hour).Unix())
+	alice := "Bearer " + signJWT(t, "s3cret", map[string]any{"sub": "alice", "exp": exp})
+	bob := "Bearer " + signJWT(t, "s3cret", map[string]any{"sub": "bob", "exp": exp})
+
+	ip := callerID(rateLimitRequest("10.0.0.1"))
+	if got := callerID(rateLimitRequest("10.0.0.1", "X-API-Key", "random-1")); got != ip {
+		t.Error("an invalid API key got its own bucket")
+	}
+	if callerID(rateLimitRequest("10.0.0.1", "X-API-Key", "random-1")) != callerID(rateLimitRequest("10.0.0.1", "X-API-Key", "random-2")) {
+		t.Error("random API keys from one address got different buckets")
+	}
+	if callerID(rateLimitRequest("10.0.0.1", "Authorization", alice)) == callerID(rateLimitRequest("10.0.0.1", "Authorization", bob)) {
+		t.Error("two users behind one address share a bucket")
+	}
+	if callerID(rateLimitRequest("10.0.0.1", "Authorization", alice)) != callerID(rateLimitRequest("10.0.0.2", "Authorization", alice)) {
+		t.Error("one user got a bucket per address")
+	}
+	if callerID(rateLimitRequest("10.0.0.1", "X-API-Key", "key", "X-User-ID", "alice")) == callerID(rateLimitRequest("10.0.0.1", "X-API-Key", "key", "X-User-ID", "bob")) {
+		t.Error("API key users share a bucket")
+	}
+}
+
+func TestCallerIDWithoutCredentialsConfigured(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+
+	// With nothing to verify, X-User-ID is just a header and can't pick
+	// the bucket.
+	a := callerID(rateLimitRequest("10.0.0.1", "X-User-ID", "alice"))
+	b := callerID(rateLimitRequest("10.0.0.1", "X-User-ID", "bob"))
+	if a != b {
+		t.Error("unverified user ids got separate buckets")
+	}
+}
+
+func TestWithRateLimitIgnoresRandomKeys(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+	defer SetClock(func() time.Time { return testNow })()
+
+	h := WithRateLimit(func(w http.ResponseWriter, r *http.Request) {}, NewMemoryKV(), 3)
+	for i, want := range []int{200, 200, 200, 429, 429} {
+		w := httptest.NewRecorder()
+		h(w, rateLimitRequest("10.0.0.1", "X-API-Key", NewID()))
+		if w.Code != want {
+			t.Fatalf("request %d: code %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
+
+func TestSlidingWindowBoundaryBurst(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	const limit = 5
+	start := time.Date(2026, 3, 1, 12, 0, 59, 500e6, time.UTC)
+
+	check := func(at time.Time) bool {
+		t.Helper()
+		ok, _, err := slidingWindow(ctx, mem, mem, "caller", limit, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// A full burst just before the minute boundary...
+	for i := 0; i < limit; i++ {
+		if !check(start) {
+			t.Fatalf("request %d before the boundary was rejected", i+1)
+		}
+	}
+	// ...leaves no room just after it, where a fixed window would reset.
+	after := start.Add(time.Second)
+	if check(after) {
+		t.Fatal("request after the boundary was allowed; the burst straddles one window")
+	}
+	fixed := NewMemoryKV()
+	for i := 0; i < limit; i++ {
+		fixedWindow(ctx, fixed, "caller", limit, start)
+	}
+	if ok, _, _ := fixedWindow(ctx, fixed, "caller", limit, after); !ok {
+		t.Fatal("fixed window rejected the request after the boundary; the test no longer shows the difference")
+	}
+
+	// The burst keeps the caller limited until it is a full minute old.
+	if check(start.Add(30 * time.Second)) {
+		t.Fatal("allowed while the burst is still in the window")
+	}
+	if !check(start.Add(time.Minute + time.Millisecond)) {
+		t.Fatal("rejected once the burst left the window")
+	}
+}
+
+func TestSlidingWindowSeparatesCallers(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	for i := 0; i < 2; i++ {
+		slidingWindow(ctx, mem, mem, "a", 2, testNow)
+	}
+	if ok, _, _ := slidingWindow(ctx, mem, mem, "a", 2, testNow); ok {
+		t.Fatal("caller a went over its limit")
+	}
+	if ok, _, _ := slidingWindow(ctx, mem, mem, "b", 2, testNow); !ok {
+		t.Fatal("caller b was limited by caller a's requests")
+	}
+}
@@ -0,0 +1,22 @@
+package api_utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrReadOnly is returned by MutateState while the deployment is in
+// read-only mode.
+var ErrReadOnly = errors.New("planner is read-only for maintenance")
+
+// readOnlyRetryAfter is the Retry-After, in seconds, sent with ErrReadOnly.
+// Maintenance windows are minutes long, so clients shouldn't hammer us.
+const readOnlyRetryAfter = "60"
+
+// ReadOnly reports whether PLANNER_READONLY=1 is set. In read-only mode
+// every write is refused while reads keep working, so data can be
+// snapshotted or migrated without clients racing it.
+func ReadOnly() bool {
+	return strings.TrimSpace(os.Getenv("PLANNER_READONLY")) == "1"
+}
@@ -0,0 +1,91 @@
+package api_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrBodyTooComplex is wrapped by CheckJSONShape when a body, though
+// within MaxBodyBytes, is nested too deeply or holds too many items.
+var ErrBodyTooComplex = errors.New("request body too complex")
+
+// maxJSONDepth bounds object/array nesting in a request body. A planner
+// needs about five levels; the rest is headroom for nested settings.
+const maxJSONDepth = 32
+
+// MaxItems returns PLANNER_MAX_ITEMS, the most courses, tasks or grades a
+// single request may carry in each collection (default 5000).
+func MaxItems() int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("PLANNER_MAX_ITEMS")))
+	if err != nil || n <= 0 {
+		return 5000
+	}
+	return n
+}
+
+// CheckJSONShape streams through body without building it and rejects it
+// with ErrBodyTooComplex when it nests deeper than maxJSONDepth or when a
+// top-level courses, tasks or grades array has more than MaxItems
+// elements. Malformed JSON passes; decoding reports it.
+func CheckJSONShape(body []byte) error {
+	type frame struct {
+		isObj   bool
+		wantKey bool
+		key     string
+	}
+	limit := MaxItems()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var stack []frame
+	count := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if n := len(stack); n > 0 && stack[n-1].isObj && stack[n-1].wantKey {
+			if key, ok := tok.(string); ok {
+				stack[n-1].key = key
+				stack[n-1].wantKey = false
+				continue
+			}
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			if n := len(stack); n > 0 && stack[n-1].isObj {
+				stack[n-1].wantKey = true
+			}
+			if len(stack) == 1 {
+				count = 0
+			}
+			continue
+		}
+
+		// tok starts a value. Directly inside a top-level collection array
+		// that value is one more item.
+		if len(stack) == 2 && stack[0].isObj && !stack[1].isObj {
+			switch stack[0].key {
+			case "courses", "tasks", "grades":
+				if count++; count > limit {
+					return fmt.Errorf("%w: more than %d %s", ErrBodyTooComplex, limit, stack[0].key)
+				}
+			}
+		}
+		if d, ok := tok.(json.Delim); ok {
+			stack = append(stack, frame{isObj: d == '{', wantKey: d == '{'})
+			if len(stack) > maxJSONDepth {
+				return fmt.Errorf("%w: nested more than %d levels deep", ErrBodyTooComplex, maxJSONDepth)
+			}
+			continue
+		}
+		if n := len(stack); n > 0 && stack[n-1].isObj {
+			stack[n-1].wantKey = true
+		}
+	}
+}
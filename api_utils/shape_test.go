@@ -0,0 +1,61 @@
+package api_utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// nestedSettings returns a state whose settings nest depth levels below
+// the top-level object.
+func nestedSettings(depth int) string {
+	return `{"settings":` + strings.Repeat(`{"a":`, depth) + `1` + strings.Repeat(`}`, depth) + `}`
+}
+
+func items(n int) string {
+	return strings.TrimSuffix(strings.Repeat(`{"id":"x","tags":[1,2,3]},`, n), ",")
+}
+
+func TestCheckJSONShapeDepth(t *testing.T) {
+	if err := CheckJSONShape([]byte(nestedSettings(maxJSONDepth - 1))); err != nil {
+		t.Fatalf("depth %d rejected: %v", maxJSONDepth, err)
+	}
+	if err := CheckJSONShape([]byte(nestedSettings(maxJSONDepth))); !errors.Is(err, ErrBodyTooComplex) {
+		t.Fatalf("depth %d: err = %v, want ErrBodyTooComplex", maxJSONDepth+1, err)
+	}
+}
+
+func TestCheckJSONShapePathological(t *testing.T) {
+	// Half a million open brackets fit in MaxBodyBytes but would make a
+	// full decode recurse that deep.
+	body := strings.Repeat("[", 500_000)
+	if err := CheckJSONShape([]byte(body)); !errors.Is(err, ErrBodyTooComplex) {
+		t.Fatalf("err = %v, want ErrBodyTooComplex", err)
+	}
+}
+
+func TestCheckJSONShapeItemLimit(t *testing.T) {
+	t.Setenv("PLANNER_MAX_ITEMS", "3")
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"at limit", `{"courses":[` + items(3) + `],"tasks":[` + items(3) + `]}`, true},
+		{"tasks over", `{"courses":[` + items(1) + `],"tasks":[` + items(4) + `]}`, false},
+		{"grades over", `{"grades":[` + items(4) + `]}`, false},
+		{"other arrays uncounted", `{"settings":{"courses":[` + items(10) + `]},"extra":[` + items(10) + `]}`, true},
+		{"malformed passes", `{"tasks":[`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckJSONShape([]byte(tt.body))
+			if tt.ok && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrBodyTooComplex) {
+				t.Fatalf("err = %v, want ErrBodyTooComplex", err)
+			}
+		})
+	}
+}
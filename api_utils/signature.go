@@ -0,0 +1,37 @@
+package api_utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrBadSignature is returned by VerifySignature when X-Signature is
+// missing or doesn't match the body.
+var ErrBadSignature = errors.New("X-Signature is missing or does not match the body")
+
+// VerifySignature checks that r's X-Signature header is the HMAC-SHA256 of
+// body under PLANNER_HMAC_SECRET, written as hex with or without the
+// "sha256=" prefix WebhookSignature uses. body must be the raw bytes as
+// received. Without a secret every request passes.
+func VerifySignature(r *http.Request, body []byte) error {
+	secret := os.Getenv("PLANNER_HMAC_SECRET")
+	if secret == "" {
+		return nil
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(r.Header.Get("X-Signature")), "sha256="))
+	if err != nil || len(got) != sha256.Size {
+		return ErrBadSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	// hmac.Equal takes the same time wherever the first difference is.
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrBadSignature
+	}
+	return nil
+}
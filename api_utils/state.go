@@ -0,0 +1,611 @@
+package api_utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the AppState.Version this server writes.
+const SchemaVersion = 2
+
+const legacyStateKey = "app_state"
+
+// AppState is the whole planner document. Version is the schema version
+// of the document shape; Revision counts successful writes and is used
+// for optimistic concurrency on PUT.
+type AppState struct {
+	Version  int `json:"version"`
+	Revision int `json:"revision"`
+	// UpdatedAt is when the state was last written (RFC 3339, UTC). It is
+	// set by MutateState; states saved before it existed have none.
+	UpdatedAt string           `json:"updated_at,omitempty"`
+	Courses   []map[string]any `json:"courses"`
+	Tasks     []map[string]any `json:"tasks"`
+	Grades    []map[string]any `json:"grades"`
+	Settings  map[string]any   `json:"settings"`
+}
+
+// builtinDefaultState is the starter planner used when no template is
+// configured; see DefaultState.
+func builtinDefaultState() AppState {
+	return AppState{
+		Version: SchemaVersion,
+		Courses: []map[string]any{},
+		Tasks:   []map[string]any{},
+		Grades:  []map[string]any{},
+		Settings: map[string]any{
+			"semesterName": "Semester",
+			"weekStartsOn": 1,
+			"theme":        "light",
+			"defaultView":  "dashboard",
+		},
+	}
+}
+
+// StateKey returns the KV key holding a user's planner. An empty userID
+// maps to the legacy single-user key so existing deployments keep working.
+func StateKey(userID string) string {
+	if userID == "" {
+		return legacyStateKey
+	}
+	return legacyStateKey + ":" + userID
+}
+
+// NormalizeState fills missing collections and known settings while
+// preserving any extra keys the client sent.
+func NormalizeState(st *AppState) {
+	if st.Version == 0 {
+		st.Version = SchemaVersion
+	}
+	if st.Courses == nil {
+		st.Courses = []map[string]any{}
+	}
+	if st.Tasks == nil {
+		st.Tasks = []map[string]any{}
+	}
+	if st.Grades == nil {
+		st.Grades = []map[string]any{}
+	}
+	if st.Settings == nil {
+		st.Settings = map[string]any{}
+	}
+
+	if _, ok := st.Settings["semesterName"]; !ok {
+		st.Settings["semesterName"] = "Semester"
+	}
+	st.Settings["weekStartsOn"] = normalizeWeekStart(st.Settings["weekStartsOn"])
+	if _, ok := st.Settings["theme"]; !ok {
+		st.Settings["theme"] = "light"
+	}
+	if _, ok := st.Settings["defaultView"]; !ok {
+		st.Settings["defaultView"] = "dashboard"
+	}
+}
+
+var weekdayNames = map[string]int{
+	"sunday": 0, "monday": 1, "tuesday": 2, "wednesday": 3,
+	"thursday": 4, "friday": 5, "saturday": 6,
+}
+
+// WeekStartsOn returns the planner's first day of the week, 0 (Sunday)
+// through 6.
+func WeekStartsOn(st AppState) int {
+	return normalizeWeekStart(st.Settings["weekStartsOn"])
+}
+
+// normalizeWeekStart coerces the representations clients have sent for
+// weekStartsOn (0-6 as a number or numeric string, or a day name such as
+// "Sunday" or "sun") into 0 (Sunday) through 6. Anything unrecognized
+// becomes 1, Monday.
+func normalizeWeekStart(v any) int {
+	switch x := v.(type) {
+	case float64: // JSON numbers decode as float64
+		if x == float64(int(x)) && x >= 0 && x <= 6 {
+			return int(x)
+		}
+	case int:
+		if x >= 0 && x <= 6 {
+			return x
+		}
+	case string:
+		s := strings.ToLower(strings.TrimSpace(x))
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 6 {
+			return n
+		}
+		if n, ok := weekdayNames[s]; ok {
+			return n
+		}
+		if len(s) >= 3 {
+			for name, n := range weekdayNames {
+				if strings.HasPrefix(name, s) {
+					return n
+				}
+			}
+		}
+	}
+	return 1
+}
+
+// ValidateState checks the minimum shape the planner relies on and returns
+// one FieldError per problem, located within the submitted state.
+func ValidateState(st AppState) []FieldError {
+	var errs []FieldError
+	courseIDs := map[string]bool{}
+	for i, c := range st.Courses {
+		if id, ok := c["id"].(string); ok && id != "" {
+			courseIDs[id] = true
+		}
+		errs = append(errs, PrefixFieldErrors(ValidateCourse(c), fmt.Sprintf("courses[%d]", i), fmt.Sprintf("/courses/%d", i))...)
+	}
+	for i, t := range st.Tasks {
+		errs = append(errs, PrefixFieldErrors(ValidateTask(t), fmt.Sprintf("tasks[%d]", i), fmt.Sprintf("/tasks/%d", i))...)
+	}
+	for i, g := range st.Grades {
+		loc, path := fmt.Sprintf("grades[%d]", i), fmt.Sprintf("/grades/%d", i)
+		if cid, present := g["courseId"]; present && cid != nil {
+			id, ok := cid.(string)
+			if !ok || (id != "" && !courseIDs[id]) {
+				errs = append(errs, FieldError{loc, path + "/courseId", FieldUnknownReference, fmt.Sprintf("courseId %v does not match any course", cid)})
+			}
+		}
+		for _, f := range []string{"scoreEarned", "scoreTotal", "weight"} {
+			if v, present := g[f]; present && v != nil {
+				if _, ok := v.(float64); !ok {
+					errs = append(errs, FieldError{loc, path + "/" + f, FieldInvalidType, f + " must be a number"})
+				}
+			}
+		}
+	}
+	errs = append(errs, duplicateIDs("courses", st.Courses)...)
+	errs = append(errs, duplicateIDs("tasks", st.Tasks)...)
+	errs = append(errs, duplicateIDs("grades", st.Grades)...)
+	return errs
+}
+
+// duplicateIDs reports every item in a collection whose id was already
+// used by an earlier one; the join and detail endpoints assume ids are
+// unique.
+func duplicateIDs(name string, items []map[string]any) []FieldError {
+	var errs []FieldError
+	seen := map[string]bool{}
+	for i, it := range items {
+		id, _ := it["id"].(string)
+		if id == "" {
+			continue
+		}
+		if seen[id] {
+			errs = append(errs, FieldError{fmt.Sprintf("%s[%d]", name, i), fmt.Sprintf("/%s/%d/id", name, i), FieldDuplicate, fmt.Sprintf("duplicate id %q", id)})
+		}
+		seen[id] = true
+	}
+	return errs
+}
+
+// ValidateCourse checks a single course the way ValidateState does. Paths
+// are relative to the course; see PrefixFieldErrors.
+func ValidateCourse(c map[string]any) []FieldError {
+	var errs []FieldError
+	if id, ok := c["id"].(string); !ok || id == "" {
+		errs = append(errs, FieldError{Path: "/id", Code: FieldRequired, Message: "id must be a non-empty string"})
+	}
+	if name, ok := c["name"].(string); !ok || strings.TrimSpace(name) == "" {
+		errs = append(errs, FieldError{Path: "/name", Code: FieldRequired, Message: "name must be a non-empty string"})
+	}
+	if v, set := c["archived"]; set && v != nil {
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, FieldError{Path: "/archived", Code: FieldInvalidType, Message: "archived must be a boolean"})
+		}
+	}
+	return errs
+}
+
+// ValidateTask checks a single task the way ValidateState does. Paths are
+// relative to the task; see PrefixFieldErrors.
+func ValidateTask(t map[string]any) []FieldError {
+	var errs []FieldError
+	if id, ok := t["id"].(string); !ok || id == "" {
+		errs = append(errs, FieldError{Path: "/id", Code: FieldRequired, Message: "id must be a non-empty string"})
+	}
+	if title, ok := t["title"].(string); !ok || strings.TrimSpace(title) == "" {
+		errs = append(errs, FieldError{Path: "/title", Code: FieldRequired, Message: "title must be a non-empty string"})
+	}
+	if _, set := t["order"]; set {
+		if _, ok := TaskOrder(t); !ok {
+			errs = append(errs, FieldError{Path: "/order", Code: FieldInvalidType, Message: "order must be an integer"})
+		}
+	}
+	if v, set := t["reminderLeadMinutes"]; set && v != nil {
+		if _, ok := TaskReminderLead(t); !ok {
+			errs = append(errs, FieldError{Path: "/reminderLeadMinutes", Code: FieldInvalidType, Message: "reminderLeadMinutes must be a number of minutes, zero or more"})
+		}
+	}
+	return errs
+}
+
+// IndexByID returns the position of the item whose "id" equals id, or -1.
+func IndexByID(items []map[string]any, id string) int {
+	for i, it := range items {
+		if s, ok := it["id"].(string); ok && s == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Codes for FieldError.Code.
+const (
+	FieldRequired         = "required"          // missing or empty
+	FieldInvalidType      = "invalid_type"      // present but the wrong kind of value
+	FieldUnknownReference = "unknown_reference" // points at an item that doesn't exist
+	FieldDuplicate        = "duplicate"         // an id already used
+)
+
+// FieldError is one validation problem. Path is a JSON Pointer (RFC 6901)
+// into the submitted document, e.g. "/courses/2/name", so clients can
+// highlight the offending field.
+type FieldError struct {
+	// Loc is the older "courses[2]" form of the item's position, kept for
+	// the string messages in "details".
+	Loc     string `json:"-"`
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Loc == "" {
+		return e.Message
+	}
+	return e.Loc + ": " + e.Message
+}
+
+// PrefixFieldErrors places errors found in one item at position loc/path
+// of the document, e.g. ValidateTask's "/title" at "/tasks/3".
+func PrefixFieldErrors(errs []FieldError, loc, path string) []FieldError {
+	for i := range errs {
+		errs[i].Loc = loc
+		errs[i].Path = path + errs[i].Path
+	}
+	return errs
+}
+
+// ValidationError reports a state that failed ValidateState.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Problems returns the errors as "courses[2]: message" strings, the form
+// responses carried before field paths were added.
+func (e *ValidationError) Problems() []string {
+	out := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		out[i] = fe.String()
+	}
+	return out
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid state: " + strings.Join(e.Problems(), "; ")
+}
+
+// ConflictError reports a write based on a stale revision. Current is the
+// state the server holds.
+type ConflictError struct {
+	Current AppState
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict: server is at revision %d", e.Current.Revision)
+}
+
+// LoadState reads and decodes the state under key, migrating it to the
+// current schema and returning the default state when nothing is stored.
+func LoadState(ctx context.Context, c KV, key string) (AppState, error) {
+	st, _, _, err := loadState(ctx, c, key)
+	return st, err
+}
+
+// loadState is LoadState that also returns the stored blob and whether one
+// existed.
+func loadState(ctx context.Context, c KV, key string) (AppState, string, bool, error) {
+	val, err := c.GetString(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return DefaultState(), "", false, nil
+	}
+	if err != nil {
+		return AppState{}, "", false, err
+	}
+	if strings.TrimSpace(val) == "" {
+		return DefaultState(), "", false, nil
+	}
+	st, _, err := Migrate([]byte(val))
+	if err != nil {
+		return AppState{}, "", false, err
+	}
+	NormalizeState(&st)
+	return st, val, true, nil
+}
+
+// ReadStateBlob returns the JSON for the state under key as stored, or the
+// default state when nothing is stored. A blob in an older schema is
+// migrated and written back so later reads skip the work.
+func ReadStateBlob(ctx context.Context, c KV, key string) ([]byte, error) {
+	val, err := c.GetString(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+	if strings.TrimSpace(val) == "" {
+		return MarshalState(DefaultState())
+	}
+	body := []byte(val)
+	st, migrated, err := Migrate(body)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		NormalizeState(&st)
+		if body, err = MarshalState(st); err != nil {
+			return nil, err
+		}
+		if err := c.SetBodyWithTTL(ctx, key, body, StateTTL()); err != nil {
+			LoggerFrom(ctx).Warn("migration write-back failed", "key", key, "error", err.Error())
+		}
+	}
+	return body, nil
+}
+
+// StateETag returns a strong ETag for a state blob.
+func StateETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// SaveState encodes st and writes it under key.
+func SaveState(ctx context.Context, c KV, key string, st AppState) error {
+	b, err := MarshalState(st)
+	if err != nil {
+		return err
+	}
+	// SET clears any expiry, so with a StateTTL the write sets it again.
+	if err := c.SetBodyWithTTL(ctx, key, b, StateTTL()); err != nil {
+		InvalidateStateCache(key)
+		return err
+	}
+	cacheStateWrite(key, b)
+	return nil
+}
+
+// MutateState is the read-modify-write path for every handler that changes
+// a planner: it loads the state under key, applies fn, normalizes and
+// validates the result, bumps Revision and writes it back, all while
+// holding the planner's write lock. The replaced state is kept as a
+// snapshot and the new one is published on StateChannel. Errors returned
+// by fn are passed through unchanged; in read-only mode it fails with
+// ErrReadOnly before touching the store.
+func MutateState(ctx context.Context, c KV, key string, fn func(st *AppState) error) (AppState, error) {
+	return MutateStateIfMatch(ctx, c, key, "", fn)
+}
+
+// ErrPreconditionFailed is returned by MutateStateIfMatch when the stored
+// state doesn't match the If-Match condition.
+var ErrPreconditionFailed = errors.New("state does not match If-Match")
+
+// MutateStateIfMatch is MutateState guarded by an If-Match header value,
+// checked under the write lock against the ETag GET /api/state would send
+// for the stored JSON (the default state's, when nothing is stored). "*"
+// matches only when a state is stored; an empty ifMatch always matches.
+// A failed check returns ErrPreconditionFailed.
+func MutateStateIfMatch(ctx context.Context, c KV, key, ifMatch string, fn func(st *AppState) error) (AppState, error) {
+	if ReadOnly() {
+		return AppState{}, ErrReadOnly
+	}
+	release, err := lockState(ctx, c, key)
+	if err != nil {
+		return AppState{}, err
+	}
+	defer release()
+
+	st, prev, found, err := loadState(ctx, c, key)
+	if err != nil {
+		return AppState{}, err
+	}
+	if ifMatch != "" {
+		current := []byte(prev)
+		if !found {
+			if current, err = MarshalState(st); err != nil {
+				return AppState{}, err
+			}
+		}
+		if !ifMatchOK(ifMatch, StateETag(current), found) {
+			return AppState{}, ErrPreconditionFailed
+		}
+	}
+	gone, err := applyMutation(&st, fn)
+	if err != nil {
+		return AppState{}, err
+	}
+	if err := SaveState(ctx, c, key, st); err != nil {
+		return AppState{}, err
+	}
+	if found {
+		if err := pushSnapshot(ctx, c, key, prev); err != nil {
+			LoggerFrom(ctx).Warn("snapshot failed", "key", key, "error", err.Error())
+		}
+	}
+	if err := pushTombstones(ctx, c, key, gone); err != nil {
+		LoggerFrom(ctx).Warn("tombstones failed", "key", key, "error", err.Error())
+	}
+	publishState(ctx, c, key, st)
+	return st, nil
+}
+
+// DeleteState removes the planner at key outright, together with its
+// history, tombstones and task attachments, so reads fall back to the
+// default state and /api/changes has nothing from before to replay. It
+// holds the same write lock as MutateState. A stored state that no longer
+// decodes is still deleted; its attachments are left for Compact.
+func DeleteState(ctx context.Context, c KV, key string) error {
+	if ReadOnly() {
+		return ErrReadOnly
+	}
+	release, err := lockState(ctx, c, key)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ops := []KVOp{
+		{Kind: KVDel, Key: key},
+		{Kind: KVDel, Key: HistoryKey(key)},
+		{Kind: KVDel, Key: TombstoneKey(key)},
+	}
+	val, err := c.GetString(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if st, _, err := Migrate([]byte(val)); err == nil {
+		for _, t := range st.Tasks {
+			if id, _ := t["id"].(string); id != "" {
+				ops = append(ops, deleteAttachmentOps(AttachmentKey(key, id))...)
+			}
+		}
+	}
+	err = c.Pipeline(ctx, ops)
+	InvalidateStateCache(key)
+	return err
+}
+
+// ifMatchOK evaluates an If-Match header against etag. Unlike
+// If-None-Match it uses strong comparison, so weak validators never match.
+func ifMatchOK(header, etag string, exists bool) bool {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if (part == "*" && exists) || part == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviewState runs fn over the state under key exactly as MutateState
+// would, including normalization, validation and the revision bump, and
+// returns the result without writing anything.
+func PreviewState(ctx context.Context, c KV, key string, fn func(st *AppState) error) (AppState, error) {
+	st, err := LoadState(ctx, c, key)
+	if err != nil {
+		return AppState{}, err
+	}
+	if _, err := applyMutation(&st, fn); err != nil {
+		return AppState{}, err
+	}
+	return st, nil
+}
+
+// applyMutation applies fn to st, then normalizes, validates and bumps the
+// revision. Items fn added or changed get a fresh updatedAt; tombstones
+// for the items it removed are returned.
+func applyMutation(st *AppState, fn func(st *AppState) error) ([]Tombstone, error) {
+	rev := st.Revision
+	before := itemFingerprints(st)
+	if err := fn(st); err != nil {
+		return nil, err
+	}
+	NormalizeState(st)
+	if errs := ValidateState(*st); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	now := Now()
+	gone := stampChanges(st, before, now)
+	st.Revision = rev + 1
+	st.UpdatedAt = now.UTC().Format(time.RFC3339Nano)
+	return gone, nil
+}
+
+// StateWarnings lists things in st that are accepted but probably not what
+// the user meant, such as tasks pointing at a course that doesn't exist.
+func StateWarnings(st AppState) []string {
+	var warnings []string
+	courseIDs := map[string]bool{}
+	for _, c := range st.Courses {
+		if id, ok := c["id"].(string); ok {
+			courseIDs[id] = true
+		}
+	}
+	for i, t := range st.Tasks {
+		if id := ItemCourseID(t); id != "" && !courseIDs[id] {
+			warnings = append(warnings, fmt.Sprintf("tasks[%d]: courseId %q does not match any course", i, id))
+		}
+		if v, ok := t["dueISO"]; ok && v != nil && v != "" {
+			if _, ok := TaskDue(t); !ok {
+				warnings = append(warnings, fmt.Sprintf("tasks[%d]: dueISO is not an RFC 3339 time", i))
+			}
+		}
+	}
+	for i, g := range st.Grades {
+		earned, ok1 := g["scoreEarned"].(float64)
+		total, ok2 := g["scoreTotal"].(float64)
+		if ok1 && ok2 && (total <= 0 || earned > total) {
+			warnings = append(warnings, fmt.Sprintf("grades[%d]: scoreEarned %v out of %v", i, earned, total))
+		}
+	}
+	return warnings
+}
+
+// StateChannel returns the pub/sub channel that announces new versions of
+// the state at key: "state-updates" for the legacy key and
+// "state-updates:<userID>" for per-user planners.
+func StateChannel(stateKey string) string {
+	return "state-updates" + strings.TrimPrefix(stateKey, legacyStateKey)
+}
+
+// publishState announces st on its StateChannel. Delivery is best effort.
+func publishState(ctx context.Context, c KV, key string, st AppState) {
+	b, err := MarshalState(st)
+	if err == nil {
+		_, err = c.Publish(ctx, StateChannel(key), b)
+	}
+	if err != nil {
+		LoggerFrom(ctx).Warn("publish failed", "key", key, "error", err.Error())
+	}
+}
+
+// WriteStateError maps errors from LoadState and MutateState onto a JSON
+// response. Handler-specific errors should be checked before calling it.
+func WriteStateError(w http.ResponseWriter, err error) {
+	var verr *ValidationError
+	var cerr *ConflictError
+	switch {
+	case errors.As(err, &verr):
+		WriteJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   "invalid state",
+			"code":    CodeInvalidState,
+			"errors":  verr.Errors,
+			"details": verr.Problems(),
+		})
+	case errors.As(err, &cerr):
+		WriteJSON(w, http.StatusConflict, map[string]any{
+			"error": "version conflict",
+			"code":  CodeVersionConflict,
+			"state": cerr.Current,
+		})
+	case errors.Is(err, ErrStateLocked):
+		w.Header().Set("Retry-After", "1")
+		WriteError(w, http.StatusServiceUnavailable, CodeStateLocked, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		WriteError(w, http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+	case errors.Is(err, ErrCourseNotFound):
+		WriteError(w, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, ErrReadOnly):
+		w.Header().Set("Retry-After", readOnlyRetryAfter)
+		WriteError(w, http.StatusServiceUnavailable, CodeReadOnly, err.Error())
+	default:
+		WriteKVError(w, err)
+	}
+}
@@ -0,0 +1,104 @@
+package api_utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func duplicatePaths(errs []FieldError) []string {
+	var paths []string
+	for _, e := range errs {
+		if e.Code == FieldDuplicate {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths
+}
+
+func TestValidateStateDuplicateIDs(t *testing.T) {
+	st := AppState{
+		Courses: []map[string]any{
+			{"id": "c1", "name": "Math"},
+			{"id": "c2", "name": "Art"},
+			{"id": "c1", "name": "Math again"},
+		},
+		Tasks: []map[string]any{
+			{"id": "x", "title": "Essay"},
+			{"id": "x", "title": "Essay copy"},
+			{"id": "x", "title": "Essay third"},
+		},
+		// The same id in another collection is not a duplicate.
+		Grades: []map[string]any{{"id": "c1", "courseId": "c2"}},
+	}
+	got := duplicatePaths(ValidateState(st))
+	want := []string{"/courses/2/id", "/tasks/1/id", "/tasks/2/id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("duplicate paths = %v, want %v", got, want)
+	}
+}
+
+func TestValidateStateUniqueIDs(t *testing.T) {
+	st := AppState{
+		Courses: []map[string]any{{"id": "c1", "name": "Math"}, {"id": "c2", "name": "Art"}},
+		Tasks:   []map[string]any{{"id": "t1", "title": "Essay"}, {"id": "t2", "title": "Quiz"}},
+		Grades:  []map[string]any{{"id": "g1", "courseId": "c1"}, {"id": "g2", "courseId": "c2"}},
+	}
+	if errs := ValidateState(st); len(errs) != 0 {
+		t.Fatalf("ValidateState = %v, want no errors", errs)
+	}
+}
+
+func TestValidateStateMissingIDsAreNotDuplicates(t *testing.T) {
+	st := AppState{Grades: []map[string]any{{"scoreEarned": 1.0}, {"scoreEarned": 2.0}}}
+	if got := duplicatePaths(ValidateState(st)); len(got) != 0 {
+		t.Fatalf("duplicate paths = %v, want none", got)
+	}
+}
+
+func TestDeleteStateRemovesEverything(t *testing.T) {
+	t.Setenv("PLANNER_READONLY", "")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	key := StateKey("alice")
+	for _, tasks := range [][]map[string]any{
+		{{"id": "t1", "title": "a"}, {"id": "t2", "title": "b"}},
+		{{"id": "t2", "title": "b"}},
+	} {
+		if _, err := MutateState(ctx, mem, key, func(st *AppState) error {
+			st.Tasks = tasks
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SaveAttachment(ctx, mem, AttachmentKey(key, "t2"), "image/png", []byte("png"))
+
+	if err := DeleteState(ctx, mem, key); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := mem.ListKeys(ctx, "")
+	if len(keys) != 0 {
+		t.Fatalf("keys left after a hard reset: %v", keys)
+	}
+	if ts, _ := TombstonesSince(ctx, mem, key, time.Time{}); len(ts) != 0 {
+		t.Errorf("tombstones from before the reset: %v", ts)
+	}
+}
+
+func TestDeleteStateTakesLock(t *testing.T) {
+	t.Setenv("PLANNER_READONLY", "")
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	key := StateKey("alice")
+	release, err := lockState(ctx, mem, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if err := DeleteState(ctx, mem, key); !errors.Is(err, ErrStateLocked) {
+		t.Fatalf("err = %v, want ErrStateLocked", err)
+	}
+}
@@ -0,0 +1,40 @@
+package api_utils
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// StateTTL returns PLANNER_STATE_TTL (e.g. "720h"), after which a planner
+// nobody reads or writes expires along with its history. Unset or invalid
+// keeps planners forever.
+func StateTTL() time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("PLANNER_STATE_TTL")))
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// RefreshStateTTL restarts the expiry clock of the planner at key, its
+// history and its tombstones, making StateTTL a sliding window. Writes
+// already do this through SaveState; reads call it, though with the state
+// cache on only once per cached entry (see claimTTLRefresh). It is a no-op
+// without a StateTTL, and failures are logged rather than returned, since
+// the read itself succeeded.
+func RefreshStateTTL(ctx context.Context, c KV, key string) {
+	ttl := StateTTL()
+	if ttl == 0 || !claimTTLRefresh(key) {
+		return
+	}
+	err := c.Pipeline(ctx, []KVOp{
+		{Kind: KVExpire, Key: key, TTL: ttl},
+		{Kind: KVExpire, Key: HistoryKey(key), TTL: ttl},
+		{Kind: KVExpire, Key: TombstoneKey(key), TTL: ttl},
+	})
+	if err != nil {
+		LoggerFrom(ctx).Warn("state ttl refresh failed", "key", key, "error", err.Error())
+	}
+}
@@ -0,0 +1,38 @@
+package api_utils
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// HandlerTimeout returns PLANNER_HANDLER_TIMEOUT as a duration (default
+// 8s). It should stay below the platform's function time limit so we can
+// answer with 504 instead of being killed.
+func HandlerTimeout() time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("PLANNER_HANDLER_TIMEOUT")))
+	if err != nil || d <= 0 {
+		return 8 * time.Second
+	}
+	return d
+}
+
+// WithTimeout runs next with a request context bounded by HandlerTimeout.
+func WithTimeout(next http.HandlerFunc) http.HandlerFunc {
+	return WithTimeoutAfter(next, HandlerTimeout())
+}
+
+// WithTimeoutAfter runs next with a request context bounded by d.
+// A non-positive d falls back to HandlerTimeout.
+func WithTimeoutAfter(next http.HandlerFunc, d time.Duration) http.HandlerFunc {
+	if d <= 0 {
+		d = HandlerTimeout()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
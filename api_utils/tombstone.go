@@ -0,0 +1,168 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// tombstoneLimit is how many tombstones are kept per planner. A client
+// offline for longer than it takes to delete this many items has to
+// download the full state instead.
+const tombstoneLimit = 1000
+
+// Tombstone records an item removed from a planner outright (not soft
+// deleted), so offline clients can drop it from their local copy.
+type Tombstone struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"` // "course", "task" or "grade"
+	DeletedAt string `json:"deletedAt"`
+}
+
+// tombstoneSuffix ends every TombstoneKey; see reservedUserIDs.
+const tombstoneSuffix = "tombstones"
+
+// TombstoneKey returns the list key holding tombstones of the state at
+// key, newest first.
+func TombstoneKey(stateKey string) string {
+	return stateKey + ":" + tombstoneSuffix
+}
+
+// collections pairs each item collection of st with its tombstone type.
+func collections(st *AppState) []struct {
+	typ   string
+	items *[]map[string]any
+} {
+	return []struct {
+		typ   string
+		items *[]map[string]any
+	}{{"course", &st.Courses}, {"task", &st.Tasks}, {"grade", &st.Grades}}
+}
+
+// itemVersion is what stampChanges compares an item against: its JSON
+// without updatedAt, and the updatedAt it had.
+type itemVersion struct {
+	fingerprint string
+	updatedAt   any
+}
+
+// itemFingerprints returns an itemVersion for every item in st with an id,
+// keyed by type and id.
+func itemFingerprints(st *AppState) map[[2]string]itemVersion {
+	out := map[[2]string]itemVersion{}
+	for _, col := range collections(st) {
+		for _, it := range *col.items {
+			if id, _ := it["id"].(string); id != "" {
+				out[[2]string{col.typ, id}] = itemVersion{fingerprint(it), it["updatedAt"]}
+			}
+		}
+	}
+	return out
+}
+
+func fingerprint(it map[string]any) string {
+	if _, ok := it["updatedAt"]; ok {
+		c := make(map[string]any, len(it))
+		for k, v := range it {
+			c[k] = v
+		}
+		delete(c, "updatedAt")
+		it = c
+	}
+	b, _ := json.Marshal(it)
+	return string(b)
+}
+
+// stampChanges sets updatedAt to now on every item of st that is new or
+// differs from before, and returns tombstones for the items in before that
+// st no longer has. updatedAt belongs to the server: on unchanged items
+// whatever a client sent is replaced by the value stored before.
+func stampChanges(st *AppState, before map[[2]string]itemVersion, now time.Time) []Tombstone {
+	stamp := now.UTC().Format(time.RFC3339Nano)
+	seen := map[[2]string]bool{}
+	for _, col := range collections(st) {
+		for _, it := range *col.items {
+			id, _ := it["id"].(string)
+			if id == "" {
+				continue
+			}
+			k := [2]string{col.typ, id}
+			seen[k] = true
+			old, ok := before[k]
+			switch {
+			case !ok || old.fingerprint != fingerprint(it):
+				it["updatedAt"] = stamp
+			case old.updatedAt == nil:
+				delete(it, "updatedAt")
+			default:
+				it["updatedAt"] = old.updatedAt
+			}
+		}
+	}
+	var gone []Tombstone
+	for k := range before {
+		if !seen[k] {
+			gone = append(gone, Tombstone{ID: k[1], Type: k[0], DeletedAt: stamp})
+		}
+	}
+	return gone
+}
+
+// pushTombstones records ts as the newest tombstones of the state at key,
+// trims the list to tombstoneLimit and deletes the attachments of removed
+// tasks, all in one Pipeline call: it runs under the state lock, and a
+// reset or import can remove hundreds of items at once.
+func pushTombstones(ctx context.Context, c KV, key string, ts []Tombstone) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	var ops []KVOp
+	for _, t := range ts {
+		if t.Type == "task" {
+			ops = append(ops, deleteAttachmentOps(AttachmentKey(key, t.ID))...)
+		}
+	}
+	if len(ts) > tombstoneLimit {
+		// The trim would drop the rest anyway.
+		ts = ts[:tombstoneLimit]
+	}
+	tk := TombstoneKey(key)
+	for _, t := range ts {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, KVOp{Kind: KVLPush, Key: tk, Value: b})
+	}
+	ops = append(ops, KVOp{Kind: KVLTrim, Key: tk, Start: 0, Stop: tombstoneLimit - 1})
+	if ttl := StateTTL(); ttl > 0 {
+		ops = append(ops, KVOp{Kind: KVExpire, Key: tk, TTL: ttl})
+	}
+	return c.Pipeline(ctx, ops)
+}
+
+// TombstonesSince returns the tombstones of the state at key recorded
+// after since, newest first.
+func TombstonesSince(ctx context.Context, c KV, key string, since time.Time) ([]Tombstone, error) {
+	vals, err := c.LRange(ctx, TombstoneKey(key), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	out := []Tombstone{}
+	for _, v := range vals {
+		var t Tombstone
+		if err := json.Unmarshal([]byte(v), &t); err != nil {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, t.DeletedAt)
+		if err != nil || !at.After(since) {
+			// Newest first, so everything from here on is older.
+			if err == nil {
+				break
+			}
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,150 @@
+package api_utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingKV is a MemoryKV that counts the calls made to it by method, so
+// tests can check how many round trips an operation costs.
+type countingKV struct {
+	*MemoryKV
+	mu    sync.Mutex
+	calls map[string]int
+	// maxMGet is the most keys a single MGet asked for.
+	maxMGet int
+}
+
+func newCountingKV() *countingKV {
+	return &countingKV{MemoryKV: NewMemoryKV(), calls: map[string]int{}}
+}
+
+func (c *countingKV) count(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[method]++
+}
+
+func (c *countingKV) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, v := range c.calls {
+		n += v
+	}
+	return n
+}
+
+func (c *countingKV) GetString(ctx context.Context, key string) (string, error) {
+	c.count("GetString")
+	return c.MemoryKV.GetString(ctx, key)
+}
+
+func (c *countingKV) MGet(ctx context.Context, keys ...string) ([]string, []bool, error) {
+	c.count("MGet")
+	c.mu.Lock()
+	c.maxMGet = max(c.maxMGet, len(keys))
+	c.mu.Unlock()
+	return c.MemoryKV.MGet(ctx, keys...)
+}
+
+func (c *countingKV) SetBody(ctx context.Context, key string, value []byte) error {
+	c.count("SetBody")
+	return c.MemoryKV.SetBody(ctx, key, value)
+}
+
+func (c *countingKV) SetBodyWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.count("SetBodyWithTTL")
+	return c.MemoryKV.SetBodyWithTTL(ctx, key, value, ttl)
+}
+
+func (c *countingKV) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	c.count("Expire")
+	return c.MemoryKV.Expire(ctx, key, ttl)
+}
+
+func (c *countingKV) Delete(ctx context.Context, key string) error {
+	c.count("Delete")
+	return c.MemoryKV.Delete(ctx, key)
+}
+
+func (c *countingKV) Pipeline(ctx context.Context, ops []KVOp) error {
+	c.count("Pipeline")
+	return c.MemoryKV.Pipeline(ctx, ops)
+}
+
+func (c *countingKV) LPush(ctx context.Context, key string, value []byte) (int64, error) {
+	c.count("LPush")
+	return c.MemoryKV.LPush(ctx, key, value)
+}
+
+func (c *countingKV) LTrim(ctx context.Context, key string, start, stop int64) error {
+	c.count("LTrim")
+	return c.MemoryKV.LTrim(ctx, key, start, stop)
+}
+
+func (c *countingKV) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	c.count("LRange")
+	return c.MemoryKV.LRange(ctx, key, start, stop)
+}
+
+func TestPushTombstonesOneCall(t *testing.T) {
+	t.Setenv("PLANNER_STATE_TTL", "720h")
+	ctx := context.Background()
+	kv := newCountingKV()
+	key := StateKey("alice")
+
+	ts := make([]Tombstone, 500)
+	for i := range ts {
+		ts[i] = Tombstone{ID: fmt.Sprint("t", i), Type: "task", DeletedAt: testNow.Format(time.RFC3339Nano)}
+	}
+	if err := pushTombstones(ctx, kv, key, ts); err != nil {
+		t.Fatal(err)
+	}
+	if kv.total() != 1 || kv.calls["Pipeline"] != 1 {
+		t.Fatalf("store calls = %v, want one Pipeline", kv.calls)
+	}
+	got, err := TombstonesSince(ctx, kv.MemoryKV, key, testNow.Add(-time.Second))
+	if err != nil || len(got) != len(ts) {
+		t.Fatalf("TombstonesSince = %d tombstones, %v; want %d", len(got), err, len(ts))
+	}
+}
+
+func TestMutateStateTombstonesManyRemovals(t *testing.T) {
+	t.Setenv("PLANNER_READONLY", "")
+	ctx := context.Background()
+	kv := newCountingKV()
+	key := StateKey("alice")
+	defer SetClock(func() time.Time { return testNow })()
+
+	if _, err := MutateState(ctx, kv, key, func(st *AppState) error {
+		for i := 0; i < tombstoneLimit+200; i++ {
+			st.Tasks = append(st.Tasks, map[string]any{"id": fmt.Sprint("t", i), "title": "x"})
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	kv.calls = map[string]int{}
+	if _, err := MutateState(ctx, kv, key, func(st *AppState) error {
+		st.Tasks = nil
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The one LPush is the snapshot of the previous state.
+	if kv.calls["LPush"] > 1 {
+		t.Fatalf("store calls = %v; tombstones should go in one Pipeline", kv.calls)
+	}
+	if n := kv.total(); n > 10 {
+		t.Fatalf("removing %d tasks took %d store calls: %v", tombstoneLimit+200, n, kv.calls)
+	}
+	got, _ := TombstonesSince(ctx, kv.MemoryKV, key, testNow.Add(-time.Second))
+	if len(got) != tombstoneLimit {
+		t.Fatalf("kept %d tombstones, want %d", len(got), tombstoneLimit)
+	}
+}
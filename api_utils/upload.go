@@ -0,0 +1,89 @@
+package api_utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrNoUploadedFile is returned by ReadUpload when a body isn't multipart
+// or has no part with the requested form name.
+var ErrNoUploadedFile = errors.New("no file in upload")
+
+// multipartSlack is how much a multipart body may exceed the file limit,
+// for boundaries, part headers and small form fields.
+const multipartSlack = 64 << 10
+
+// IsMultipart reports whether r carries a multipart/form-data body.
+func IsMultipart(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "multipart/form-data"
+}
+
+// ReadUpload streams a multipart/form-data body and returns the contents
+// of the part named field, which may be at most max bytes, with its media
+// type (see RequestMedia). Browsers often label YAML and TOML files
+// application/octet-stream, so the file name's extension is used when the
+// part's own type says nothing useful. Parts before the file are skipped
+// without being buffered. Size and read errors are the ones ReadBodyLimit
+// returns.
+func ReadUpload(r *http.Request, field string, max int64) ([]byte, string, error) {
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(nil, r.Body, max+multipartSlack)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrNoUploadedFile, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", ErrNoUploadedFile
+		}
+		if err != nil {
+			return nil, "", uploadError(err)
+		}
+		if part.FormName() != field {
+			part.Close()
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(part, max+1))
+		if err != nil {
+			return nil, "", uploadError(err)
+		}
+		if int64(len(body)) > max {
+			return nil, "", ErrBodyTooLarge
+		}
+		return body, uploadMedia(part.Header.Get("Content-Type"), part.FileName()), nil
+	}
+}
+
+func uploadError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return ErrBodyTooLarge
+	}
+	return fmt.Errorf("reading upload: %w", err)
+}
+
+// uploadMedia picks the media type of an uploaded file from its declared
+// type, falling back to its extension.
+func uploadMedia(contentType, filename string) string {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if _, known := mediaAliases[mt]; known {
+		return mediaAliases[mt]
+	}
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == ".yml" {
+		ext = ".yaml"
+	}
+	for media, e := range MediaExtensions {
+		if e == ext {
+			return media
+		}
+	}
+	return MediaJSON
+}
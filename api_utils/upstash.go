@@ -7,9 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -17,6 +23,18 @@ type UpstashClient struct {
 	BaseURL string
 	Token   string
 	HTTP    *http.Client
+
+	// Compress gzips values on write. Reads always detect and decompress
+	// compressed values, so toggling it never strands existing data.
+	Compress bool
+
+	// MaxAttempts bounds how many times a request is tried; see do.
+	MaxAttempts int
+
+	// KeyPrefix is prepended to every key and channel name, so several
+	// deployments can share one database. Callers always pass and get
+	// back unprefixed keys.
+	KeyPrefix string
 }
 
 func NewUpstashFromEnv() (*UpstashClient, error) {
@@ -26,18 +44,151 @@ func NewUpstashFromEnv() (*UpstashClient, error) {
 		return nil, errors.New("missing UPSTASH_REDIS_REST_URL or UPSTASH_REDIS_REST_TOKEN")
 	}
 	return &UpstashClient{
-		BaseURL: strings.TrimRight(base, "/"),
-		Token:   tok,
-		HTTP:    &http.Client{Timeout: 10 * time.Second},
+		BaseURL:     strings.TrimRight(base, "/"),
+		Token:       tok,
+		HTTP:        sharedHTTPClient(),
+		Compress:    os.Getenv("PLANNER_KV_COMPRESS") == "1",
+		MaxAttempts: maxAttemptsFromEnv(),
+		KeyPrefix:   os.Getenv("PLANNER_KEY_PREFIX"),
 	}, nil
 }
 
+var (
+	transportOnce sync.Once
+	transport     *http.Transport
+)
+
+// sharedHTTPClient returns a client for Upstash calls on the process-wide
+// transport. Warm serverless instances build a client per request, so
+// sharing one transport lets them reuse idle keep-alive connections
+// instead of paying for a fresh TLS handshake every time.
+//
+// UPSTASH_HTTP_TIMEOUT bounds a whole call (default 10s) and
+// UPSTASH_CONNECT_TIMEOUT bounds dialing plus the TLS handshake (default
+// 3s), so an unreachable host fails fast even when the overall budget is
+// generous.
+func sharedHTTPClient() *http.Client {
+	transportOnce.Do(func() {
+		connect := durationFromEnv("UPSTASH_CONNECT_TIMEOUT", 3*time.Second)
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = connect
+		transport.MaxIdleConns = 100
+		transport.MaxIdleConnsPerHost = 32
+		transport.IdleConnTimeout = 90 * time.Second
+		transport.DisableKeepAlives = false
+	})
+	return &http.Client{
+		Timeout:   durationFromEnv("UPSTASH_HTTP_TIMEOUT", 10*time.Second),
+		Transport: transport,
+	}
+}
+
+// durationFromEnv parses the env var name as a duration such as "2s",
+// returning def when it is unset or not a positive duration.
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// maxAttemptsFromEnv reads UPSTASH_MAX_ATTEMPTS, defaulting to 3.
+func maxAttemptsFromEnv() int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("UPSTASH_MAX_ATTEMPTS")))
+	if err != nil || n < 1 {
+		return 3
+	}
+	return n
+}
+
+// ErrKeyNotFound is returned by GetString when the key does not exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrBadResponse wraps replies from Upstash that could not be understood.
+var ErrBadResponse = errors.New("upstash: malformed response")
+
+// ErrUpstashThrottled is matched by errors from calls Upstash refused with
+// 429 because the plan's request rate was exceeded. They are
+// *ThrottledError values carrying Upstash's Retry-After.
+var ErrUpstashThrottled = errors.New("upstash: request rate exceeded")
+
+// ThrottledError is a 429 from Upstash. RetryAfter is its Retry-After
+// header as sent (seconds or an HTTP date), or "" when it sent none.
+type ThrottledError struct {
+	RetryAfter string
+}
+
+func (e *ThrottledError) Error() string { return ErrUpstashThrottled.Error() }
+
+func (e *ThrottledError) Unwrap() error { return ErrUpstashThrottled }
+
 type upstashResp struct {
 	Result json.RawMessage `json:"result"`
 	Error  string          `json:"error"`
 }
 
-func (c *UpstashClient) do(ctx context.Context, method, path string, body []byte, contentType string) (upstashResp, int, error) {
+// do sends one REST call, retrying transient failures with jittered
+// exponential backoff up to MaxAttempts. GET calls are idempotent and are
+// retried on network errors and 5xx responses. Writes are only retried
+// when the connection was never established, so a request that may have
+// reached Upstash is never sent twice. Retries stop once ctx is done.
+func (c *UpstashClient) do(ctx context.Context, method, path string, body []byte, contentType string) (out upstashResp, status int, err error) {
+	start := time.Now()
+	defer func() { Metrics.ObserveKV(opName(path), time.Since(start), err) }()
+	for attempt := 1; ; attempt++ {
+		out, status, err := c.doOnce(ctx, method, path, body, contentType)
+		if err == nil || attempt >= c.MaxAttempts || ctx.Err() != nil || !retryable(method, status, err) {
+			return out, status, err
+		}
+		backoff := time.Duration(50<<attempt) * time.Millisecond
+		backoff = backoff/2 + time.Duration(rand.Int64N(int64(backoff)))
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return out, status, err
+		case <-t.C:
+		}
+	}
+}
+
+// opName returns the Redis command a REST path invokes, e.g. "get".
+func opName(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexAny(path, "/?"); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		return "command"
+	}
+	return path
+}
+
+// retryable reports whether a failed call may safely be tried again.
+func retryable(method string, status int, err error) bool {
+	if method == http.MethodGet {
+		return status == 0 || status >= 500
+	}
+	return status == 0 && notSent(err)
+}
+
+// notSent reports whether err means the request never left this process:
+// the dial failed or the host did not resolve.
+func notSent(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (c *UpstashClient) doOnce(ctx context.Context, method, path string, body []byte, contentType string) (upstashResp, int, error) {
 	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(body))
 	if err != nil {
 		return upstashResp{}, 0, err
@@ -52,39 +203,501 @@ func (c *UpstashClient) do(ctx context.Context, method, path string, body []byte
 		return upstashResp{}, 0, err
 	}
 	defer res.Body.Close()
-	b, _ := io.ReadAll(res.Body)
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return upstashResp{}, res.StatusCode, fmt.Errorf("upstash: reading response: %w", err)
+	}
 
 	var out upstashResp
-	_ = json.Unmarshal(b, &out)
+	// Batch endpoints such as /multi-exec reply with a bare array, one
+	// result object per command; hand it back whole as the Result.
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) && res.StatusCode >= 200 && res.StatusCode <= 299 {
+		out.Result = b
+		return out, res.StatusCode, nil
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return upstashResp{}, res.StatusCode, &ThrottledError{RetryAfter: strings.TrimSpace(res.Header.Get("Retry-After"))}
+	}
+	decodeErr := json.Unmarshal(b, &out)
 	if out.Error != "" {
 		return out, res.StatusCode, fmt.Errorf("upstash error: %s", out.Error)
 	}
 	if res.StatusCode < 200 || res.StatusCode > 299 {
 		return out, res.StatusCode, fmt.Errorf("upstash http %d", res.StatusCode)
 	}
+	if decodeErr != nil || len(out.Result) == 0 {
+		return out, res.StatusCode, fmt.Errorf("%w: %q", ErrBadResponse, truncate(b, 200))
+	}
 	return out, res.StatusCode, nil
 }
 
-func (c *UpstashClient) GetString(ctx context.Context, key string) (string, bool, error) {
-	out, _, err := c.do(ctx, http.MethodGet, "/get/"+escapeKey(key), nil, "")
+// GetString returns the value stored at key. A key that does not exist
+// yields ErrKeyNotFound; any other error means the store could not be
+// read and says nothing about whether the key exists. Redis GET only ever
+// yields strings, so a reply holding a JSON object, array or number is
+// rejected with ErrBadResponse rather than passed off as the value.
+func (c *UpstashClient) GetString(ctx context.Context, key string) (string, error) {
+	out, _, err := c.do(ctx, http.MethodGet, "/get/"+escapeKey(c.key(key)), nil, "")
 	if err != nil {
-		return "", false, err
+		return "", err
 	}
-	if string(out.Result) == "null" || len(out.Result) == 0 {
-		return "", false, nil
+	if string(out.Result) == "null" {
+		return "", ErrKeyNotFound
 	}
 	var s string
 	if err := json.Unmarshal(out.Result, &s); err != nil {
-		return string(out.Result), true, nil
+		return "", fmt.Errorf("%w: GET %s returned %s, not a string", ErrBadResponse, key, truncate(out.Result, 100))
+	}
+	s, err = decompressValue(s)
+	if err != nil {
+		return "", err
 	}
-	return s, true, nil
+	return s, nil
 }
 
 func (c *UpstashClient) SetBody(ctx context.Context, key string, value []byte) error {
-	_, _, err := c.do(ctx, http.MethodPost, "/set/"+escapeKey(key), value, "text/plain; charset=utf-8")
+	value, err := c.encode(value)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do(ctx, http.MethodPost, "/set/"+escapeKey(c.key(key)), value, "text/plain; charset=utf-8")
+	return err
+}
+
+// Backend names the storage backend, for diagnostics.
+func (c *UpstashClient) Backend() string { return "upstash" }
+
+// Ping checks that the store is reachable and the token is accepted.
+func (c *UpstashClient) Ping(ctx context.Context) error {
+	_, _, err := c.do(ctx, http.MethodGet, "/ping", nil, "")
+	return err
+}
+
+// PingInfo sends PING and DBSIZE in a single /pipeline call. If the
+// pipeline itself is refused or garbled it falls back to a plain Ping and
+// reports the key count as unknown. DBSIZE counts the whole database,
+// including keys outside KeyPrefix.
+func (c *UpstashClient) PingInfo(ctx context.Context) (KVInfo, error) {
+	info := KVInfo{Keys: -1}
+	out, status, err := c.do(ctx, http.MethodPost, "/pipeline", []byte(`[["PING"],["DBSIZE"]]`), "application/json")
+	if err != nil {
+		if status == 0 && !errors.Is(err, ErrBadResponse) {
+			return info, err
+		}
+		return info, c.Ping(ctx)
+	}
+	var results []upstashResp
+	if err := json.Unmarshal(out.Result, &results); err != nil || len(results) != 2 {
+		return info, c.Ping(ctx)
+	}
+	if results[0].Error != "" {
+		return info, fmt.Errorf("upstash error: %s", results[0].Error)
+	}
+	if results[1].Error == "" {
+		_ = json.Unmarshal(results[1].Result, &info.Keys)
+	}
+	return info, nil
+}
+
+// MGet reads several keys in one round trip. The returned slices line up
+// with keys; a missing key yields "" with its found flag false.
+func (c *UpstashClient) MGet(ctx context.Context, keys ...string) ([]string, []bool, error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	escaped := make([]string, len(keys))
+	for i, k := range keys {
+		escaped[i] = escapeKey(c.key(k))
+	}
+	out, _, err := c.do(ctx, http.MethodGet, "/mget/"+strings.Join(escaped, "/"), nil, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw []*string
+	if err := json.Unmarshal(out.Result, &raw); err != nil {
+		return nil, nil, fmt.Errorf("upstash mget: unexpected result %s", string(out.Result))
+	}
+	if len(raw) != len(keys) {
+		return nil, nil, fmt.Errorf("upstash mget: got %d values for %d keys", len(raw), len(keys))
+	}
+	vals := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	for i, v := range raw {
+		if v == nil {
+			continue
+		}
+		if vals[i], err = decompressValue(*v); err != nil {
+			return nil, nil, err
+		}
+		found[i] = true
+	}
+	return vals, found, nil
+}
+
+// SetBodyWithTTL stores value under key and lets it expire after ttl.
+// A non-positive ttl behaves like SetBody. Upstash expiry has second
+// granularity, so sub-second remainders are rounded up.
+func (c *UpstashClient) SetBodyWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return c.SetBody(ctx, key, value)
+	}
+	value, err := c.encode(value)
+	if err != nil {
+		return err
+	}
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	path := "/set/" + escapeKey(c.key(key)) + "?EX=" + strconv.FormatInt(secs, 10)
+	_, _, err = c.do(ctx, http.MethodPost, path, value, "text/plain; charset=utf-8")
+	return err
+}
+
+// SetNX stores value under key only if the key does not exist yet, with
+// an expiry of ttl. It reports whether this call created the key.
+func (c *UpstashClient) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	value, err := c.encode(value)
+	if err != nil {
+		return false, err
+	}
+	path := "/set/" + escapeKey(c.key(key)) + "?NX"
+	if ttl > 0 {
+		path += "&EX=" + strconv.FormatInt(int64((ttl+time.Second-1)/time.Second), 10)
+	}
+	out, _, err := c.do(ctx, http.MethodPost, path, value, "text/plain; charset=utf-8")
+	if err != nil {
+		return false, err
+	}
+	return string(out.Result) == `"OK"`, nil
+}
+
+// Expire sets key to expire after ttl, rounded up to whole seconds.
+func (c *UpstashClient) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	_, _, err := c.do(ctx, http.MethodPost, "/expire/"+escapeKey(c.key(key))+"/"+strconv.FormatInt(secs, 10), nil, "")
+	return err
+}
+
+// Increment atomically adds by to the counter at key and returns the new
+// total. A missing key counts from zero.
+func (c *UpstashClient) Increment(ctx context.Context, key string, by int64) (int64, error) {
+	out, _, err := c.do(ctx, http.MethodPost, "/incrby/"+escapeKey(c.key(key))+"/"+strconv.FormatInt(by, 10), nil, "")
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := json.Unmarshal(out.Result, &n); err != nil {
+		return 0, fmt.Errorf("upstash incrby: unexpected result %s", string(out.Result))
+	}
+	return n, nil
+}
+
+// LPush prepends value to the list at key and returns the new length.
+func (c *UpstashClient) LPush(ctx context.Context, key string, value []byte) (int64, error) {
+	value, err := c.encode(value)
+	if err != nil {
+		return 0, err
+	}
+	out, _, err := c.do(ctx, http.MethodPost, "/lpush/"+escapeKey(c.key(key)), value, "text/plain; charset=utf-8")
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := json.Unmarshal(out.Result, &n); err != nil {
+		return 0, fmt.Errorf("upstash lpush: unexpected result %s", string(out.Result))
+	}
+	return n, nil
+}
+
+// LTrim keeps only the elements of the list at key between start and stop
+// (inclusive, Redis index semantics).
+func (c *UpstashClient) LTrim(ctx context.Context, key string, start, stop int64) error {
+	path := "/ltrim/" + escapeKey(c.key(key)) + "/" + strconv.FormatInt(start, 10) + "/" + strconv.FormatInt(stop, 10)
+	_, _, err := c.do(ctx, http.MethodPost, path, nil, "")
+	return err
+}
+
+// LRange returns the elements of the list at key between start and stop
+// (inclusive, Redis index semantics).
+func (c *UpstashClient) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	path := "/lrange/" + escapeKey(c.key(key)) + "/" + strconv.FormatInt(start, 10) + "/" + strconv.FormatInt(stop, 10)
+	out, _, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	var vals []string
+	if err := json.Unmarshal(out.Result, &vals); err != nil {
+		return nil, fmt.Errorf("upstash lrange: unexpected result %s", string(out.Result))
+	}
+	for i, v := range vals {
+		if vals[i], err = decompressValue(v); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// Publish sends msg to subscribers of channel and returns how many
+// received it.
+func (c *UpstashClient) Publish(ctx context.Context, channel string, msg []byte) (int64, error) {
+	out, _, err := c.do(ctx, http.MethodPost, "/publish/"+escapeKey(c.key(channel)), msg, "text/plain; charset=utf-8")
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := json.Unmarshal(out.Result, &n); err != nil {
+		return 0, fmt.Errorf("upstash publish: unexpected result %s", string(out.Result))
+	}
+	return n, nil
+}
+
+// Subscribe is not available over the Upstash REST API, which has no
+// long-lived connection to deliver messages on. It always returns an
+// error wrapping errors.ErrUnsupported.
+func (c *UpstashClient) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	return nil, fmt.Errorf("upstash REST: subscribe: %w", errors.ErrUnsupported)
+}
+
+// ListKeys returns every key starting with prefix. It walks SCAN cursors
+// until the server reports cursor 0, so it never blocks the store the way
+// KEYS would.
+func (c *UpstashClient) ListKeys(ctx context.Context, prefix string) ([]string, error) {
+	pattern := globEscaper.Replace(c.key(prefix)) + "*"
+	var keys []string
+	cursor := "0"
+	for {
+		path := "/scan/" + cursor + "/match/" + escapeKey(pattern) + "/count/100"
+		out, _, err := c.do(ctx, http.MethodGet, path, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		var page []json.RawMessage
+		if err := json.Unmarshal(out.Result, &page); err != nil || len(page) != 2 {
+			return nil, fmt.Errorf("upstash scan: unexpected result %s", string(out.Result))
+		}
+		var next json.Number
+		if err := json.Unmarshal(page[0], &next); err != nil {
+			var s string
+			if err := json.Unmarshal(page[0], &s); err != nil {
+				return nil, fmt.Errorf("upstash scan: bad cursor %s", string(page[0]))
+			}
+			next = json.Number(s)
+		}
+		var batch []string
+		if err := json.Unmarshal(page[1], &batch); err != nil {
+			return nil, fmt.Errorf("upstash scan: bad key list %s", string(page[1]))
+		}
+		for _, k := range batch {
+			keys = append(keys, strings.TrimPrefix(k, c.KeyPrefix))
+		}
+		cursor = next.String()
+		if cursor == "0" {
+			return keys, nil
+		}
+	}
+}
+
+// globEscaper neutralises Redis glob metacharacters so a prefix matches
+// literally in a SCAN pattern.
+var globEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"?", `\?`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// KVOpKind names a command that can run inside Pipeline.
+type KVOpKind string
+
+const (
+	KVSet              KVOpKind = "set"
+	KVDel              KVOpKind = "del"
+	KVIncr             KVOpKind = "incr"
+	KVExpire           KVOpKind = "expire"
+	KVZAdd             KVOpKind = "zadd"
+	KVZRemRangeByScore KVOpKind = "zremrangebyscore"
+	KVLPush            KVOpKind = "lpush"
+	KVLTrim            KVOpKind = "ltrim"
+)
+
+// KVOp is one command in a Pipeline. Value and TTL apply to KVSet (a
+// non-positive TTL never expires); TTL also applies to KVExpire; By
+// applies to KVIncr; Score and Member to KVZAdd; Min and Max to
+// KVZRemRangeByScore; Value to KVLPush; Start and Stop to KVLTrim. The
+// sorted-set kinds need a store that implements ZSetKV.
+type KVOp struct {
+	Kind   KVOpKind
+	Key    string
+	Value  []byte
+	TTL    time.Duration
+	By     int64
+	Score  float64
+	Member string
+	Min    float64
+	Max    float64
+	Start  int64
+	Stop   int64
+}
+
+// Pipeline runs ops as a single MULTI/EXEC transaction through Upstash's
+// /multi-exec endpoint: no other client's command runs between them, and
+// nothing is applied if the transaction is rejected as a whole. A command
+// that fails on its own (e.g. INCR on a non-number) is reported as an
+// error, but, as in Redis, the other commands still apply.
+func (c *UpstashClient) Pipeline(ctx context.Context, ops []KVOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	cmds := make([][]string, 0, len(ops))
+	for _, op := range ops {
+		switch op.Kind {
+		case KVSet:
+			v, err := c.encode(op.Value)
+			if err != nil {
+				return err
+			}
+			cmd := []string{"SET", c.key(op.Key), string(v)}
+			if op.TTL > 0 {
+				cmd = append(cmd, "EX", strconv.FormatInt(int64((op.TTL+time.Second-1)/time.Second), 10))
+			}
+			cmds = append(cmds, cmd)
+		case KVDel:
+			cmds = append(cmds, []string{"DEL", c.key(op.Key)})
+		case KVIncr:
+			cmds = append(cmds, []string{"INCRBY", c.key(op.Key), strconv.FormatInt(op.By, 10)})
+		case KVExpire:
+			cmds = append(cmds, []string{"EXPIRE", c.key(op.Key), strconv.FormatInt(int64((op.TTL+time.Second-1)/time.Second), 10)})
+		case KVZAdd:
+			cmds = append(cmds, []string{"ZADD", c.key(op.Key), formatScore(op.Score), op.Member})
+		case KVZRemRangeByScore:
+			cmds = append(cmds, []string{"ZREMRANGEBYSCORE", c.key(op.Key), formatScore(op.Min), formatScore(op.Max)})
+		case KVLPush:
+			v, err := c.encode(op.Value)
+			if err != nil {
+				return err
+			}
+			cmds = append(cmds, []string{"LPUSH", c.key(op.Key), string(v)})
+		case KVLTrim:
+			cmds = append(cmds, []string{"LTRIM", c.key(op.Key), strconv.FormatInt(op.Start, 10), strconv.FormatInt(op.Stop, 10)})
+		default:
+			return fmt.Errorf("pipeline: unknown op %q", op.Kind)
+		}
+	}
+	body, err := json.Marshal(cmds)
+	if err != nil {
+		return err
+	}
+	out, _, err := c.do(ctx, http.MethodPost, "/multi-exec", body, "application/json")
+	if err != nil {
+		return err
+	}
+	var results []upstashResp
+	if err := json.Unmarshal(out.Result, &results); err != nil || len(results) != len(ops) {
+		return fmt.Errorf("%w: %q", ErrBadResponse, truncate(out.Result, 200))
+	}
+	for i, r := range results {
+		if r.Error != "" {
+			return fmt.Errorf("upstash error in pipeline op %d (%s %s): %s", i, ops[i].Kind, ops[i].Key, r.Error)
+		}
+	}
+	return nil
+}
+
+// ZAdd adds member to the sorted set at key, or updates its score.
+func (c *UpstashClient) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	_, err := c.command(ctx, "ZADD", c.key(key), formatScore(score), member)
 	return err
 }
 
+// ZRangeByScore returns the members of key scored min through max, lowest
+// first.
+func (c *UpstashClient) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	out, err := c.command(ctx, "ZRANGEBYSCORE", c.key(key), formatScore(min), formatScore(max))
+	if err != nil {
+		return nil, err
+	}
+	members := []string{}
+	if err := json.Unmarshal(out.Result, &members); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrBadResponse, truncate(out.Result, 200))
+	}
+	return members, nil
+}
+
+// ZRemRangeByScore removes the members of key scored min through max.
+func (c *UpstashClient) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	_, err := c.command(ctx, "ZREMRANGEBYSCORE", c.key(key), formatScore(min), formatScore(max))
+	return err
+}
+
+// ZCard returns the number of members in the sorted set at key.
+func (c *UpstashClient) ZCard(ctx context.Context, key string) (int64, error) {
+	out, err := c.command(ctx, "ZCARD", c.key(key))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := json.Unmarshal(out.Result, &n); err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrBadResponse, truncate(out.Result, 200))
+	}
+	return n, nil
+}
+
+// command sends one Redis command as a JSON array to the REST root, which
+// spares escaping members that aren't safe in a URL path.
+func (c *UpstashClient) command(ctx context.Context, args ...string) (upstashResp, error) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return upstashResp{}, err
+	}
+	out, _, err := c.do(ctx, http.MethodPost, "/", body, "application/json")
+	return out, err
+}
+
+// formatScore renders a sorted-set score the way Redis parses it,
+// including the open bounds -inf and +inf.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsInf(f, 1):
+		return "+inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Delete removes key. Deleting a key that does not exist is not an error;
+// Upstash reports it as a zero count.
+func (c *UpstashClient) Delete(ctx context.Context, key string) error {
+	out, _, err := c.do(ctx, http.MethodPost, "/del/"+escapeKey(c.key(key)), nil, "")
+	if err != nil {
+		return err
+	}
+	var n int64
+	if err := json.Unmarshal(out.Result, &n); err != nil {
+		return fmt.Errorf("upstash del: unexpected result %s", string(out.Result))
+	}
+	return nil
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
+
+// encode applies write-side value encoding (currently optional compression).
+func (c *UpstashClient) encode(value []byte) ([]byte, error) {
+	if !c.Compress {
+		return value, nil
+	}
+	return compressValue(value)
+}
+
+// key applies KeyPrefix to k.
+func (c *UpstashClient) key(k string) string {
+	return c.KeyPrefix + k
+}
+
 func escapeKey(k string) string {
 	repl := strings.NewReplacer(
 		"%", "%25",
@@ -0,0 +1,204 @@
+package api_utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockUpstash answers Upstash REST calls from handle, which gets the
+// unescaped path segments (e.g. ["incrby", "k", "2"]) and returns the
+// reply body.
+func mockUpstash(t *testing.T, handle func(args []string) string) *UpstashClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+		args := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		w.Write([]byte(handle(args)))
+	}))
+	t.Cleanup(srv.Close)
+	return &UpstashClient{BaseURL: srv.URL, Token: "tok", HTTP: srv.Client(), MaxAttempts: 1}
+}
+
+func TestUpstashIncrement(t *testing.T) {
+	var mu sync.Mutex
+	counters := map[string]int64{}
+	c := mockUpstash(t, func(args []string) string {
+		if len(args) != 3 || args[0] != "incrby" {
+			return `{"error":"ERR unknown command"}`
+		}
+		by, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return `{"error":"ERR value is not an integer or out of range"}`
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		counters[args[1]] += by
+		b, _ := json.Marshal(map[string]int64{"result": counters[args[1]]})
+		return string(b)
+	})
+	c.KeyPrefix = "test:"
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		by, want int64
+	}{{1, 1}, {5, 6}, {-2, 4}} {
+		n, err := c.Increment(ctx, "usage:alice", step.by)
+		if err != nil || n != step.want {
+			t.Fatalf("Increment(%d) = %d, %v; want %d", step.by, n, err, step.want)
+		}
+	}
+	if counters["test:usage:alice"] != 4 {
+		t.Fatalf("stored counters = %v, want the prefixed key at 4", counters)
+	}
+}
+
+func TestUpstashIncrementErrors(t *testing.T) {
+	ctx := context.Background()
+	c := mockUpstash(t, func([]string) string { return `{"error":"ERR value is not an integer or out of range"}` })
+	if _, err := c.Increment(ctx, "k", 1); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("error reply: err = %v", err)
+	}
+	c = mockUpstash(t, func([]string) string { return `{"result":"OK"}` })
+	if _, err := c.Increment(ctx, "k", 1); err == nil {
+		t.Error("non-integer result was accepted")
+	}
+	c.Token = "wrong"
+	if _, err := c.Increment(ctx, "k", 1); err == nil {
+		t.Error("unauthorized reply was accepted")
+	}
+}
+
+func TestMemoryKVIncrement(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryKV()
+	if n, err := m.Increment(ctx, "k", 3); err != nil || n != 3 {
+		t.Fatalf("first Increment = %d, %v; want 3", n, err)
+	}
+	if n, err := m.Increment(ctx, "k", 4); err != nil || n != 7 {
+		t.Fatalf("second Increment = %d, %v; want 7", n, err)
+	}
+	m.SetBody(ctx, "s", []byte("text"))
+	if _, err := m.Increment(ctx, "s", 1); err == nil {
+		t.Fatal("incremented a non-integer value")
+	}
+}
+
+func TestUpstashGetStringRejectsNonStrings(t *testing.T) {
+	stored := map[string]string{
+		"str":    `{"result":"{\"version\":2}"}`,
+		"object": `{"result":{"version":2}}`,
+		"array":  `{"result":[1,2]}`,
+		"number": `{"result":42}`,
+		"none":   `{"result":null}`,
+	}
+	c := mockUpstash(t, func(args []string) string { return stored[args[len(args)-1]] })
+	ctx := context.Background()
+
+	if s, err := c.GetString(ctx, "str"); err != nil || s != `{"version":2}` {
+		t.Fatalf("GetString(str) = %q, %v", s, err)
+	}
+	if _, err := c.GetString(ctx, "none"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("GetString(none) err = %v, want ErrKeyNotFound", err)
+	}
+	for _, key := range []string{"object", "array", "number"} {
+		s, err := c.GetString(ctx, key)
+		if !errors.Is(err, ErrBadResponse) || s != "" {
+			t.Errorf("GetString(%s) = %q, %v; want ErrBadResponse", key, s, err)
+		}
+	}
+}
+
+func TestUpstashPipelineRequest(t *testing.T) {
+	var path string
+	var cmds [][]string
+	reply := `[{"result":"OK"},{"result":1},{"result":"OK"}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&cmds); err != nil {
+			t.Errorf("body is not a JSON list of commands: %v", err)
+		}
+		w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+	c := &UpstashClient{BaseURL: srv.URL, Token: "tok", HTTP: srv.Client(), MaxAttempts: 1, KeyPrefix: "test:"}
+	ctx := context.Background()
+	ops := []KVOp{
+		{Kind: KVSet, Key: "a", Value: []byte("v"), TTL: 90 * time.Second},
+		{Kind: KVLPush, Key: "l", Value: []byte("x")},
+		{Kind: KVLTrim, Key: "l", Start: 0, Stop: 9},
+	}
+
+	if err := c.Pipeline(ctx, ops); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/multi-exec" {
+		t.Errorf("path = %q, want /multi-exec", path)
+	}
+	want := [][]string{
+		{"SET", "test:a", "v", "EX", "90"},
+		{"LPUSH", "test:l", "x"},
+		{"LTRIM", "test:l", "0", "9"},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+
+	// A command that fails on its own is reported with its position.
+	reply = `[{"result":"OK"},{"error":"WRONGTYPE Operation against a key holding the wrong kind of value"},{"result":"OK"}]`
+	err := c.Pipeline(ctx, ops)
+	if err == nil || !strings.Contains(err.Error(), "op 1 (lpush l)") || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Errorf("per-op error: err = %v", err)
+	}
+	// So is a reply that doesn't have one result per command.
+	reply = `[{"result":"OK"}]`
+	if err := c.Pipeline(ctx, ops); !errors.Is(err, ErrBadResponse) {
+		t.Errorf("short reply: err = %v, want ErrBadResponse", err)
+	}
+}
+
+func TestMemoryKVPipelineIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryKV()
+	m.SetBody(ctx, "a", []byte("old"))
+	m.SetBody(ctx, "text", []byte("not a number"))
+	m.LPush(ctx, "l", []byte("x"))
+
+	err := m.Pipeline(ctx, []KVOp{
+		{Kind: KVSet, Key: "a", Value: []byte("new")},
+		{Kind: KVSet, Key: "b", Value: []byte("new")},
+		{Kind: KVLPush, Key: "l", Value: []byte("y")},
+		{Kind: KVDel, Key: "text"},
+		{Kind: KVIncr, Key: "c", By: 1},
+		{Kind: KVLPush, Key: "a", Value: []byte("z")}, // a is a string: fails
+	})
+	if err == nil {
+		t.Fatal("pipeline with a failing op succeeded")
+	}
+	if v, _ := m.GetString(ctx, "a"); v != "old" {
+		t.Errorf("a = %q, want old", v)
+	}
+	if v, _ := m.GetString(ctx, "text"); v != "not a number" {
+		t.Errorf("text = %q; the delete wasn't rolled back", v)
+	}
+	for _, k := range []string{"b", "c"} {
+		if _, err := m.GetString(ctx, k); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("%s was written by the failed pipeline", k)
+		}
+	}
+	if l, _ := m.LRange(ctx, "l", 0, -1); !reflect.DeepEqual(l, []string{"x"}) {
+		t.Errorf("l = %q, want [x]", l)
+	}
+}
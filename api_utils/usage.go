@@ -0,0 +1,109 @@
+package api_utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageTTL is how long a daily usage counter is kept: long enough to read
+// yesterday's full count the next day.
+const usageTTL = 48 * time.Hour
+
+// usageDay formats the UTC day used in usage keys.
+const usageDay = "20060102"
+
+// UsageKey returns the counter key for userID's requests on day (UTC).
+// The shared legacy planner's user is "".
+func UsageKey(userID string, day time.Time) string {
+	return "usage:" + userID + ":" + day.UTC().Format(usageDay)
+}
+
+// usageTimeout bounds one background counter write.
+const usageTimeout = 5 * time.Second
+
+// countUsage counts one authenticated request by userID in the background,
+// so the store round trip stays off the request path. The count keeps the
+// request's logger but not its deadline.
+func countUsage(ctx context.Context, c KV, userID string) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, usageTimeout)
+		defer cancel()
+		incrementUsage(ctx, c, userID)
+	}()
+}
+
+// incrementUsage counts one authenticated request by userID against
+// today's counter in c. Counting is best effort: a failure is logged and never
+// fails the request, and a serverless instance frozen before a background
+// count finishes loses it.
+func incrementUsage(ctx context.Context, c KV, userID string) {
+	key := UsageKey(userID, Now())
+	err := c.Pipeline(ctx, []KVOp{
+		{Kind: KVIncr, Key: key, By: 1},
+		{Kind: KVExpire, Key: key, TTL: usageTTL},
+	})
+	if err != nil {
+		LoggerFrom(ctx).Warn("usage count failed", "error", err.Error())
+	}
+}
+
+// UsageUsers returns the users that have any usage counter stored.
+func UsageUsers(ctx context.Context, c KV) ([]string, error) {
+	keys, err := c.ListKeys(ctx, "usage:")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var users []string
+	for _, k := range keys {
+		rest := strings.TrimPrefix(k, "usage:")
+		i := strings.LastIndex(rest, ":")
+		if i < 0 || seen[rest[:i]] {
+			continue
+		}
+		seen[rest[:i]] = true
+		users = append(users, rest[:i])
+	}
+	return users, nil
+}
+
+// UsageCounts returns each user's request count for every UTC day from
+// from to to inclusive, keyed by user and then by YYYY-MM-DD, read with
+// MGet in batches. Days without a counter count as 0.
+func UsageCounts(ctx context.Context, c KV, users []string, from, to time.Time) (map[string]map[string]int64, error) {
+	var days []time.Time
+	for d := from.UTC(); !d.After(to.UTC()); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	out := make(map[string]map[string]int64, len(users))
+	if len(users) == 0 || len(days) == 0 {
+		return out, nil
+	}
+	keys := make([]string, 0, len(users)*len(days))
+	for _, u := range users {
+		for _, d := range days {
+			keys = append(keys, UsageKey(u, d))
+		}
+	}
+	vals, found, err := mgetBatched(ctx, c, keys)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for _, u := range users {
+		counts := make(map[string]int64, len(days))
+		for _, d := range days {
+			var n int64
+			if found[i] {
+				n, _ = strconv.ParseInt(vals[i], 10, 64)
+			}
+			counts[d.Format(time.DateOnly)] = n
+			i++
+		}
+		out[u] = counts
+	}
+	return out, nil
+}
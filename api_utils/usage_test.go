@@ -0,0 +1,69 @@
+package api_utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthorizeCountsUsage(t *testing.T) {
+	t.Setenv("PLANNER_API_KEY", "key")
+	t.Setenv("PLANNER_JWT_SECRET", "")
+	mem := NewMemoryKV()
+	defer SetClock(func() time.Time { return testNow })()
+
+	r := httptest.NewRequest(http.MethodGet, "/api/state", nil)
+	r.Header.Set("X-API-Key", "key")
+	r.Header.Set("X-User-ID", "alice")
+	if _, ok := NewHandler(mem, Config{}).Authorize(httptest.NewRecorder(), r); !ok {
+		t.Fatal("Authorize rejected a valid key")
+	}
+
+	// The count is written in the background.
+	key := UsageKey("alice", testNow)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		v, err := mem.GetString(context.Background(), key)
+		if err == nil && v == "1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, %v; want 1", key, v, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUsageCounts(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryKV()
+	day := testNow
+	for i := 0; i < 3; i++ {
+		if _, err := mem.Increment(ctx, UsageKey("alice", day), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := mem.Increment(ctx, UsageKey("bob", day.AddDate(0, 0, -1)), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := UsageUsers(ctx, mem)
+	if err != nil || len(users) != 2 {
+		t.Fatalf("UsageUsers = %v, %v; want alice and bob", users, err)
+	}
+	counts, err := UsageCounts(ctx, mem, []string{"alice", "bob"}, day.AddDate(0, 0, -1), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts["alice"]["2026-03-01"]; got != 3 {
+		t.Errorf("alice today = %d, want 3", got)
+	}
+	if got := counts["alice"]["2026-02-28"]; got != 0 {
+		t.Errorf("alice yesterday = %d, want 0", got)
+	}
+	if got := counts["bob"]["2026-02-28"]; got != 2 {
+		t.Errorf("bob yesterday = %d, want 2", got)
+	}
+}
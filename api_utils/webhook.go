@@ -0,0 +1,89 @@
+package api_utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds each delivery; a slow receiver must not keep the
+// function alive.
+const webhookTimeout = 5 * time.Second
+
+var webhookHTTP = &http.Client{Timeout: webhookTimeout}
+
+// WebhookEvent is the body POSTed to PLANNER_WEBHOOK_URL.
+type WebhookEvent struct {
+	Type      string `json:"type"`
+	UserID    string `json:"userId,omitempty"`
+	Version   int    `json:"version"`
+	Revision  int    `json:"revision"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// WebhookSignature returns the X-Planner-Signature value for body:
+// "sha256=" and the hex HMAC-SHA256 of the body under secret. Receivers
+// recompute it with the shared secret and compare in constant time.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NotifyStateUpdated sends a "state.updated" event for st to
+// PLANNER_WEBHOOK_URL, if set, in the background. Delivery is best
+// effort: failures are logged and never affect the request. When
+// PLANNER_WEBHOOK_SECRET is set the body is signed with WebhookSignature.
+func NotifyStateUpdated(ctx context.Context, userID string, st AppState) {
+	url := strings.TrimSpace(os.Getenv("PLANNER_WEBHOOK_URL"))
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(WebhookEvent{
+		Type:      "state.updated",
+		UserID:    userID,
+		Version:   st.Version,
+		Revision:  st.Revision,
+		UpdatedAt: st.UpdatedAt,
+	})
+	if err != nil {
+		return
+	}
+	secret := os.Getenv("PLANNER_WEBHOOK_SECRET")
+	// The request's context ends with the response; the delivery keeps its
+	// values (for logging) but not its cancellation.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := deliverWebhook(ctx, url, secret, body); err != nil {
+			LoggerFrom(ctx).Warn("webhook delivery failed", "error", err.Error())
+		}
+	}()
+}
+
+func deliverWebhook(ctx context.Context, url, secret string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Planner-Signature", WebhookSignature(secret, body))
+	}
+	res, err := webhookHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %d", res.StatusCode)
+	}
+	return nil
+}
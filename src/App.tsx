@@ -186,6 +186,7 @@ export default function App() {
   const [selectedDay, setSelectedDay] = useState(startOfDay(now));
 
   const debounced = useRef<number | null>(null);
+  const revision = useRef(0);
 
   // Theme
   const theme = state.settings.theme ?? "light";
@@ -235,6 +236,7 @@ export default function App() {
           grades: Array.isArray((data as any).grades) ? ((data as any).grades as GradeItem[]) : [],
         };
 
+        revision.current = typeof (data as any).revision === "number" ? (data as any).revision : 0;
         setState(merged);
         saveOfflineCache(merged);
         clearOfflineCache();
@@ -261,9 +263,16 @@ export default function App() {
         const res = await fetch("/api/state", {
           method: "PUT",
           headers: { "Content-Type": "application/json" },
-          body: JSON.stringify(state),
+          body: JSON.stringify({ ...state, revision: revision.current }),
         });
+        if (res.status === 409) {
+          setSync("error");
+          setToast({ open: true, type: "error", message: "Changed on another device - reload to sync" });
+          return;
+        }
         if (!res.ok) throw new Error("save failed");
+        const saved = await res.json();
+        if (typeof saved?.revision === "number") revision.current = saved.revision;
 
         setSync("saved");
         setToast({ open: true, type: "success", message: "Saved" });